@@ -1,40 +1,178 @@
 package config
 
 import (
+	"compress/flate"
 	"fmt"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+
+	"dataset-splitter/internal/storage"
+)
+
+// アーカイブ形式
+const (
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveZip   = "zip"
+)
+
+// 複数ソースで同じ出力ファイル名が衝突した場合の方針
+const (
+	MergeKeepFirst = "first"  // 先に指定したソースのファイルを残す
+	MergeRename    = "rename" // 後のソースのファイル名にソース番号を付けてすべて残す
+	MergeError     = "error"  // エラーとして中断する
+)
+
+// 拡張子と内容の形式が異なるファイルの扱い
+const (
+	MismatchKeep   = "keep"   // 警告を出して元の名前のまま残す
+	MismatchRename = "rename" // 内容の形式の拡張子に変えて出力する
+	MismatchDrop   = "drop"   // 分割の対象から除外する
+)
+
+// 内容が同じファイルの扱い
+const (
+	DedupKeepFirst = "first" // 最初のファイルのみを残す
+	DedupDropAll   = "drop"  // 重複したファイルをすべて除外する
+	DedupError     = "error" // エラーとして中断する
+)
+
+// 内容が同じファイルが異なるラベル（クラス/サブクラス）に属する場合の扱い
+const (
+	ConflictReport    = "report"   // 除外せず一覧のみ出力する
+	ConflictDropAll   = "drop"     // 組のファイルをすべて除外する
+	ConflictKeepFirst = "first"    // 最初のラベルのみを残す
+	ConflictMajority  = "majority" // 最も多くのファイルがあるラベルのみを残す
+)
+
+// 画像の検証方法
+const (
+	VerifyHeader = "header" // ヘッダーのみデコード（image.DecodeConfig）
+	VerifyFull   = "full"   // 画像全体をデコード（途中で切れたファイルも検出）
+)
+
+// 幅・高さを指定したリサイズの合わせ方
+const (
+	ResizeFit  = "fit"  // 縦横比を保って収まるように拡大・縮小し、余白を黒で埋める
+	ResizeFill = "fill" // 縦横比を無視して引き伸ばす
+	ResizeCrop = "crop" // 縦横比を保って覆うように拡大・縮小し、中央を切り出す
+)
+
+// 再エンコードする形式
+const (
+	EncodeJPEG = "jpeg"
+	EncodePNG  = "png"
+)
+
+// 色モード
+const (
+	ColorRGB  = "rgb"  // 8ビットRGB（透過は白で合成）
+	ColorGray = "gray" // 8ビットグレースケール
+)
+
+// 8ビットRGB以外の画像（グレースケール・CMYK・パレット・透過・16ビット）の扱い
+const (
+	ColorCheckReport  = "report"  // 除外・変換せず一覧のみ出力する
+	ColorCheckConvert = "convert" // コピー時に8ビットRGBへ変換する
+	ColorCheckExclude = "exclude" // 分割の対象から除外する
+)
+
+// 統計の出力形式
+const (
+	StatsTable    = "table"    // 整形したテキストの表
+	StatsJSON     = "json"     // JSON
+	StatsMarkdown = "markdown" // Markdownの表
 )
 
 // Config は設定情報を保持
 type Config struct {
-	SourceDir      string  // ソースディレクトリ
-	DestDir        string  // 出力先ディレクトリ
-	TrainingRatio  float64 // 教師データ比率
-	MinFileCount   int     // 最小ファイル数
-	TarOutput      bool    // tar出力フラグ
-	MaxConcurrent  int     // 最大並列度
-	MaxCopyWorkers int     // 最大コピーワーカー数
-	BinaryMode     bool    // 二値分類モード
-	PositiveClass  string  // positiveクラス名
+	SourceDirs          []string // ソース（複数指定時は同名のクラス・サブクラスを統合）
+	MergePolicy         string   // 複数ソースでファイル名が衝突した場合の方針 (first, rename, error)
+	LabelFile           string   // ラベルファイル（指定時はディレクトリ構造の代わりに使用）
+	Resplit             bool     // ソースを以前の実行の出力として読み込み、分割し直す
+	ArchiveRoot         string   // アーカイブ内でソースのルートとして使うディレクトリ（空: 自動判定, .: アーカイブ直下）
+	DestDir             string   // 出力先ディレクトリ
+	S3Endpoint          string   // S3互換オブジェクトストレージのエンドポイント（空の場合は環境変数・AWS既定）
+	S3Region            string   // S3のリージョン（空の場合は環境変数・us-east-1）
+	TrainingRatio       float64  // 教師データ比率
+	FileTypes           string   // 対象とするファイル種別（カンマ区切り: image, audio, text）
+	Extensions          string   // 追加で対象とする拡張子（カンマ区切り）
+	Include             string   // 対象とするファイルのglobパターン（カンマ区切り）
+	Exclude             string   // 除外するファイル・ディレクトリのglobパターン（カンマ区切り）
+	FollowSymlinks      bool     // シンボリックリンクをたどって走査
+	KeepJunk            bool     // 隠しファイル・OSやNASのメタデータを除外しない
+	Sniff               bool     // ファイル先頭のバイト列で形式を判定
+	SniffMismatch       string   // 拡張子と内容の形式が異なるファイルの扱い (keep, rename, drop)
+	MinSize             string   // 対象とするファイルサイズの下限（例: 1KB、空・0: 制限なし）
+	MaxSize             string   // 対象とするファイルサイズの上限（例: 50MB、空・0: 制限なし）
+	Dedup               string   // 内容が同じファイルの扱い（空: 検出しない, first, drop, error）
+	LabelConflicts      string   // 内容が同じファイルが異なるラベルに属する場合の扱い（空: 検出しない, report, drop, first, majority）
+	LeakCheck           bool     // 教師データと検証データにまたがる類似画像を検出
+	LeakDistance        int      // 類似とみなすdHashのハミング距離
+	LeakFix             bool     // 類似画像の組を同じ分割（教師データ）へ移す
+	VerifyImages        string   // 画像の検証方法（空: 検証しない, header, full）
+	Quarantine          bool     // 検証で除外したファイルを quarantine/ にコピー
+	MinWidth            int      // 画像の幅の下限（0: 制限なし）
+	MaxWidth            int      // 画像の幅の上限（0: 制限なし）
+	MinHeight           int      // 画像の高さの下限（0: 制限なし）
+	MaxHeight           int      // 画像の高さの上限（0: 制限なし）
+	MinAspect           float64  // 縦横比（幅÷高さ）の下限（0: 制限なし）
+	MaxAspect           float64  // 縦横比（幅÷高さ）の上限（0: 制限なし）
+	MinFileCount        int      // 最小ファイル数
+	ApplyOrientation    bool     // コピー時にJPEGのEXIFの向きを画素に反映
+	StripMetadata       bool     // コピー時にEXIF（位置情報を含む）・XMP・IPTCを取り除く
+	MaxSide             int      // コピー時に長辺をこの値まで縮小（0: 縮小しない）
+	ResizeSize          string   // コピー時にリサイズする大きさ（WxH、空: リサイズしない）
+	ResizeMode          string   // 大きさを指定したリサイズの合わせ方 (fit, fill, crop)
+	Encode              string   // コピー時に再エンコードする形式（空: 元の形式, jpeg, png）
+	Quality             int      // 再エンコードするJPEGの品質 (1-100)
+	ColorMode           string   // コピー時に変換する色モード（空: そのまま, rgb, gray）
+	ColorCheck          string   // 8ビットRGB以外の画像の扱い（空: 検査しない, report, convert, exclude）
+	TarOutput           bool     // tar出力フラグ（ArchiveFormat "tar" と同等）
+	ArchiveFormat       string   // アーカイブ形式 (tar, tar.gz, zip)
+	CompressionLevel    int      // 圧縮レベル (-1: 既定, 0-9)
+	ArchiveDirect       bool     // 出力ディレクトリを作らずアーカイブへ直接書き込む
+	ArchivePath         string   // アーカイブの出力パス（空の場合は出力先ディレクトリの隣）
+	ArchivePerSplit     bool     // 分割ごとに個別のアーカイブを作成
+	ReproducibleArchive bool     // 再現可能なアーカイブを作成（エントリ整列・所有者と更新日時の固定）
+	ListFiles           bool     // 「相対パス ラベル番号」形式のリストファイルを出力
+	MetadataJSONL       bool     // Hugging Face imagefolder形式のmetadata.jsonlを分割ごとに出力
+	MaxConcurrent       int      // 最大並列度
+	MaxCopyWorkers      int      // 最大コピーワーカー数
+	BinaryMode          bool     // 二値分類モード
+	PositiveClass       string   // positiveクラス名
+	StatsFormat         string   // 統計の出力形式 (table, json, markdown)
 }
 
 // NewDefaultConfig はデフォルト設定を返す
 func NewDefaultConfig() *Config {
 	return &Config{
-		TrainingRatio:  0.7,
-		MinFileCount:   50,
-		TarOutput:      false,
-		MaxConcurrent:  runtime.NumCPU() / 2,
-		MaxCopyWorkers: runtime.NumCPU(),
-		BinaryMode:     false,
-		PositiveClass:  "",
+		MergePolicy:      "first",
+		SniffMismatch:    MismatchKeep,
+		TrainingRatio:    0.7,
+		FileTypes:        "image",
+		MinSize:          "1",
+		LeakDistance:     4,
+		ResizeMode:       ResizeFit,
+		Quality:          95,
+		MinFileCount:     50,
+		TarOutput:        false,
+		ArchiveFormat:    "",
+		CompressionLevel: flate.DefaultCompression,
+		MaxConcurrent:    runtime.NumCPU() / 2,
+		MaxCopyWorkers:   runtime.NumCPU(),
+		BinaryMode:       false,
+		PositiveClass:    "",
+		StatsFormat:      StatsTable,
 	}
 }
 
 // Validate は設定の妥当性をチェック
 func (c *Config) Validate() error {
-	if c.SourceDir == "" {
-		return fmt.Errorf("ソースディレクトリが指定されていません")
+	if err := c.ValidateSource(); err != nil {
+		return err
 	}
 	if c.DestDir == "" {
 		return fmt.Errorf("出力先ディレクトリが指定されていません")
@@ -42,6 +180,129 @@ func (c *Config) Validate() error {
 	if c.TrainingRatio <= 0.0 || c.TrainingRatio >= 1.0 {
 		return fmt.Errorf("教師データ比率は0.0より大きく1.0より小さい値である必要があります")
 	}
+	if c.BinaryMode && c.PositiveClass == "" {
+		return fmt.Errorf("二値分類モードではpositiveクラスを指定する必要があります")
+	}
+	switch c.Dedup {
+	case "", DedupKeepFirst, DedupDropAll, DedupError:
+	default:
+		return fmt.Errorf("重複ファイルの扱いは %s, %s, %s のいずれかである必要があります", DedupKeepFirst, DedupDropAll, DedupError)
+	}
+	switch c.LabelConflicts {
+	case "", ConflictReport, ConflictDropAll, ConflictKeepFirst, ConflictMajority:
+	default:
+		return fmt.Errorf("ラベルの矛盾の扱いは %s, %s, %s, %s のいずれかである必要があります", ConflictReport, ConflictDropAll, ConflictKeepFirst, ConflictMajority)
+	}
+	if c.LeakDistance < 0 || c.LeakDistance > 32 {
+		return fmt.Errorf("類似画像のハミング距離は0から32の範囲である必要があります")
+	}
+	if c.LeakFix && !c.LeakCheck {
+		return fmt.Errorf("-leak-fix には -leak-check の指定が必要です")
+	}
+	switch c.VerifyImages {
+	case "", VerifyHeader, VerifyFull:
+	default:
+		return fmt.Errorf("画像の検証方法は %s, %s のいずれかである必要があります", VerifyHeader, VerifyFull)
+	}
+	if c.Quarantine && c.VerifyImages == "" {
+		return fmt.Errorf("-quarantine には画像の検証方法の指定が必要です")
+	}
+	if c.MinWidth < 0 || c.MaxWidth < 0 || c.MinHeight < 0 || c.MaxHeight < 0 {
+		return fmt.Errorf("画像の幅・高さの制限は0以上である必要があります")
+	}
+	if (c.MaxWidth > 0 && c.MinWidth > c.MaxWidth) || (c.MaxHeight > 0 && c.MinHeight > c.MaxHeight) {
+		return fmt.Errorf("画像の幅・高さの下限は上限以下である必要があります")
+	}
+	if c.MinAspect < 0 || c.MaxAspect < 0 {
+		return fmt.Errorf("縦横比の制限は0以上である必要があります")
+	}
+	if c.MaxAspect > 0 && c.MinAspect > c.MaxAspect {
+		return fmt.Errorf("縦横比の下限は上限以下である必要があります")
+	}
+	if c.MaxSide < 0 {
+		return fmt.Errorf("長辺の上限は0以上である必要があります")
+	}
+	if _, _, err := c.GetResizeSize(); err != nil {
+		return err
+	}
+	if c.MaxSide > 0 && c.ResizeSize != "" {
+		return fmt.Errorf("長辺の上限とリサイズする大きさは同時に指定できません")
+	}
+	switch c.ResizeMode {
+	case ResizeFit, ResizeFill, ResizeCrop:
+	default:
+		return fmt.Errorf("リサイズの合わせ方は %s, %s, %s のいずれかである必要があります", ResizeFit, ResizeFill, ResizeCrop)
+	}
+	switch c.Encode {
+	case "", EncodeJPEG, EncodePNG:
+	default:
+		return fmt.Errorf("再エンコードする形式は %s, %s のいずれかである必要があります", EncodeJPEG, EncodePNG)
+	}
+	if c.Quality < 1 || c.Quality > 100 {
+		return fmt.Errorf("JPEGの品質は1から100の範囲である必要があります")
+	}
+	switch c.ColorMode {
+	case "", ColorRGB, ColorGray:
+	default:
+		return fmt.Errorf("色モードは %s, %s のいずれかである必要があります", ColorRGB, ColorGray)
+	}
+	switch c.ColorCheck {
+	case "", ColorCheckReport, ColorCheckConvert, ColorCheckExclude:
+	default:
+		return fmt.Errorf("色モードの検査は %s, %s, %s のいずれかである必要があります", ColorCheckReport, ColorCheckConvert, ColorCheckExclude)
+	}
+	switch c.ArchiveFormat {
+	case "", ArchiveTar, ArchiveTarGz, ArchiveZip:
+	default:
+		return fmt.Errorf("アーカイブ形式は %s, %s, %s のいずれかである必要があります", ArchiveTar, ArchiveTarGz, ArchiveZip)
+	}
+	if (c.ArchiveDirect || c.ArchivePath != "" || c.ArchivePerSplit || c.ReproducibleArchive) && c.GetArchiveFormat() == "" {
+		return fmt.Errorf("アーカイブ関連のオプションにはアーカイブ形式の指定が必要です")
+	}
+	if storage.IsS3URL(c.DestDir) && c.GetArchiveFormat() != "" && !c.ArchiveDirect {
+		return fmt.Errorf("出力先がS3の場合、アーカイブ出力には -archive-direct の指定が必要です")
+	}
+	if c.CompressionLevel < flate.DefaultCompression || c.CompressionLevel > flate.BestCompression {
+		return fmt.Errorf("圧縮レベルは-1から9の範囲である必要があります")
+	}
+	return nil
+}
+
+// ValidateSource はソースの読み込みに関する設定の妥当性をチェック
+func (c *Config) ValidateSource() error {
+	if len(c.SourceDirs) == 0 {
+		return fmt.Errorf("ソースディレクトリが指定されていません")
+	}
+	if c.LabelFile != "" && len(c.SourceDirs) > 1 {
+		return fmt.Errorf("ラベルファイルを使用する場合はソースを1つだけ指定してください")
+	}
+	if c.LabelFile != "" && c.Resplit {
+		return fmt.Errorf("ラベルファイルと再分割は同時に指定できません")
+	}
+	switch c.MergePolicy {
+	case MergeKeepFirst, MergeRename, MergeError:
+	default:
+		return fmt.Errorf("統合時の衝突方針は %s, %s, %s のいずれかである必要があります", MergeKeepFirst, MergeRename, MergeError)
+	}
+	switch c.SniffMismatch {
+	case MismatchKeep, MismatchRename, MismatchDrop:
+	default:
+		return fmt.Errorf("拡張子と内容の形式が異なるファイルの扱いは %s, %s, %s のいずれかである必要があります", MismatchKeep, MismatchRename, MismatchDrop)
+	}
+	if c.SniffMismatch != MismatchKeep && !c.Sniff {
+		return fmt.Errorf("-sniff-mismatch には -sniff の指定が必要です")
+	}
+	minSize, err := c.GetMinSize()
+	if err != nil {
+		return err
+	}
+	maxSize, err := c.GetMaxSize()
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && maxSize < minSize {
+		return fmt.Errorf("ファイルサイズの上限は下限以上である必要があります")
+	}
 	if c.MinFileCount < 1 {
 		return fmt.Errorf("最小ファイル数は1以上である必要があります")
 	}
@@ -51,8 +312,18 @@ func (c *Config) Validate() error {
 	if c.MaxCopyWorkers < 1 {
 		return fmt.Errorf("最大コピーワーカー数は1以上である必要があります")
 	}
-	if c.BinaryMode && c.PositiveClass == "" {
-		return fmt.Errorf("二値分類モードではpositiveクラスを指定する必要があります")
+	return nil
+}
+
+// ValidateStats は統計表示の設定の妥当性をチェック
+func (c *Config) ValidateStats() error {
+	if err := c.ValidateSource(); err != nil {
+		return err
+	}
+	switch c.StatsFormat {
+	case StatsTable, StatsJSON, StatsMarkdown:
+	default:
+		return fmt.Errorf("統計の出力形式は %s, %s, %s のいずれかである必要があります", StatsTable, StatsJSON, StatsMarkdown)
 	}
 	return nil
 }
@@ -62,6 +333,140 @@ func (c *Config) GetValidationRatio() float64 {
 	return 1.0 - c.TrainingRatio
 }
 
+// GetResizeSize はリサイズする大きさ（WxH）の幅と高さを返す（指定がない場合は0, 0）
+func (c *Config) GetResizeSize() (int, int, error) {
+	if c.ResizeSize == "" {
+		return 0, 0, nil
+	}
+	w, h, ok := strings.Cut(strings.ToLower(c.ResizeSize), "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil || width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("リサイズする大きさは 幅x高さ（例: 224x224）の形式で指定してください: %s", c.ResizeSize)
+	}
+	return width, height, nil
+}
+
+// GetMinSize は対象とするファイルサイズの下限をバイト数で返す（0: 制限なし）
+func (c *Config) GetMinSize() (int64, error) {
+	size, err := parseFileSize(c.MinSize)
+	if err != nil {
+		return 0, fmt.Errorf("ファイルサイズの下限が不正です: %v", err)
+	}
+	return size, nil
+}
+
+// GetMaxSize は対象とするファイルサイズの上限をバイト数で返す（0: 制限なし）
+func (c *Config) GetMaxSize() (int64, error) {
+	size, err := parseFileSize(c.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("ファイルサイズの上限が不正です: %v", err)
+	}
+	return size, nil
+}
+
+// fileSizeUnits はファイルサイズの単位（長いものから順に照合する）
+var fileSizeUnits = []struct {
+	suffix string
+	scale  float64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseFileSize はファイルサイズ（例: 512, 1.5KB, 50MB）をバイト数に変換する（空の場合は0）
+// 単位は1024倍とする
+func parseFileSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if upper == "" {
+		return 0, nil
+	}
+	number, scale := upper, 1.0
+	for _, unit := range fileSizeUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			number, scale = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix)), unit.scale
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("0以上の数値と単位（B, KB, MB, GB）で指定してください: %s", s)
+	}
+	return int64(value * scale), nil
+}
+
+// GetArchiveFormat は出力するアーカイブ形式を返す（出力しない場合は空文字）
+func (c *Config) GetArchiveFormat() string {
+	if c.ArchiveFormat != "" {
+		return c.ArchiveFormat
+	}
+	if c.TarOutput {
+		return ArchiveTar
+	}
+	return ""
+}
+
+// GetArchivePath はアーカイブの出力パスを返す
+// splitが空でなければ分割ごとのアーカイブのパス（<名前>_<分割名>.<拡張子>）を返す
+func (c *Config) GetArchivePath(split string) string {
+	format := c.GetArchiveFormat()
+	archivePath := c.ArchivePath
+	if archivePath == "" {
+		if storage.IsS3URL(c.DestDir) {
+			archivePath = strings.TrimSuffix(c.DestDir, "/") + "." + format
+		} else {
+			archivePath = filepath.Clean(c.DestDir) + "." + format
+		}
+	}
+	if split == "" {
+		return archivePath
+	}
+	return strings.TrimSuffix(archivePath, "."+format) + "_" + split + "." + format
+}
+
+// UsesS3 はソース・出力先・アーカイブのいずれかにS3を使用するかどうかを返す
+func (c *Config) UsesS3() bool {
+	for _, src := range c.SourceDirs {
+		if storage.IsS3URL(src) {
+			return true
+		}
+	}
+	return storage.IsS3URL(c.DestDir) || storage.IsS3URL(c.ArchivePath)
+}
+
+// GetFileTypes は対象とするファイル種別の一覧を返す
+func (c *Config) GetFileTypes() []string {
+	return splitList(c.FileTypes)
+}
+
+// GetExtensions は追加で対象とする拡張子の一覧を返す
+func (c *Config) GetExtensions() []string {
+	return splitList(c.Extensions)
+}
+
+// GetIncludePatterns は対象とするファイルのglobパターンの一覧を返す
+func (c *Config) GetIncludePatterns() []string {
+	return splitList(c.Include)
+}
+
+// GetExcludePatterns は除外するglobパターンの一覧を返す
+func (c *Config) GetExcludePatterns() []string {
+	return splitList(c.Exclude)
+}
+
+// splitList はカンマ区切りの文字列を要素に分割（空要素は除く）
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // GetMaxConcurrent は最大並列度を返す
 func (c *Config) GetMaxConcurrent() int {
 	return c.MaxConcurrent
@@ -0,0 +1,123 @@
+package dataset
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// File はデータセット内の1ファイルとそのラベル情報
+type File struct {
+	FS        fs.FS  // ファイルを読み込むファイルシステム
+	Path      string // FS内のパス
+	Name      string // 出力ファイル名（空の場合はPathのベース名）
+	Class     string // 大まかなクラス名
+	Subclass  string // サブクラス名
+	Group     string // 同じ分割に割り当てるグループ（空の場合はファイル単位）
+	SHA256    string // 内容のSHA-256（重複検出時のみ設定）
+	Width     int    // 画像の幅（解像度の読み込み時のみ設定）
+	Height    int    // 画像の高さ（解像度の読み込み時のみ設定）
+	ColorMode string // 画像の色モード（解像度の読み込み時のみ設定。判定できない場合は空）
+}
+
+// NewFiles はパス一覧からクラス・サブクラス情報付きのファイル一覧を作成
+func NewFiles(fsys fs.FS, paths []string, className, subclassName string) []*File {
+	files := make([]*File, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, &File{FS: fsys, Path: p, Class: className, Subclass: subclassName})
+	}
+	return files
+}
+
+// OutputName は出力ファイル名を返す
+func (f *File) OutputName() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return path.Base(f.Path)
+}
+
+// Open はファイルを開く
+func (f *File) Open() (fs.File, error) {
+	return f.FS.Open(f.Path)
+}
+
+// 除外理由
+const (
+	SkipJunkFile      = "隠しファイル・メタデータ"
+	SkipJunkDir       = "隠しディレクトリ・メタデータディレクトリ"
+	SkipNotMatch      = "内容が拡張子の形式と異なる"
+	SkipMismatch      = "拡張子と異なる対象形式"
+	SkipCorrupt       = "壊れた画像"
+	SkipDuplicate     = "重複"
+	SkipResolution    = "解像度"
+	SkipAspect        = "縦横比"
+	SkipLabelConflict = "ラベルの矛盾"
+	SkipEmpty         = "空のファイル"
+	SkipFileSize      = "ファイルサイズ"
+	SkipColorMode     = "色モード"
+)
+
+// ExcludedFile は走査時に除外したファイルとその理由（一覧の出力用）
+type ExcludedFile struct {
+	Path   string // FS内のパス
+	Reason string // 除外理由
+	Detail string // 補足（ファイルサイズなど）
+}
+
+// Subclass はサブクラスとそのファイル一覧
+type Subclass struct {
+	Name     string
+	Files    []*File
+	Skipped  map[string]int // 除外理由ごとの件数
+	Excluded []ExcludedFile // 走査時に除外したファイル
+}
+
+// AddSkipped は除外した件数を記録
+func (s *Subclass) AddSkipped(reason string, count int) {
+	if count == 0 {
+		return
+	}
+	if s.Skipped == nil {
+		s.Skipped = make(map[string]int)
+	}
+	s.Skipped[reason] += count
+}
+
+// AddExcluded は除外したファイルを記録し、除外した件数に加える
+func (s *Subclass) AddExcluded(filePath, reason, detail string) {
+	s.Excluded = append(s.Excluded, ExcludedFile{Path: filePath, Reason: reason, Detail: detail})
+	s.AddSkipped(reason, 1)
+}
+
+// SkippedSummary は除外した件数の概要を返す（除外がない場合は空文字）
+func (s *Subclass) SkippedSummary() string {
+	reasons := make([]string, 0, len(s.Skipped))
+	for reason := range s.Skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		parts = append(parts, fmt.Sprintf("%s %d件", reason, s.Skipped[reason]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Class は大まかなクラスとそのサブクラス一覧
+type Class struct {
+	Name       string
+	Subclasses []*Subclass
+}
+
+// FileCount はクラス内の全ファイル数を返す
+func (c *Class) FileCount() int {
+	count := 0
+	for _, sub := range c.Subclasses {
+		count += len(sub.Files)
+	}
+	return count
+}
@@ -0,0 +1,426 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/storage"
+)
+
+// reproducibleModTime は再現可能モードで全エントリに設定する更新日時
+// zipで表現できる最小の日時（1980-01-01）を使用する
+var reproducibleModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ArchiveOptions はアーカイブ出力の設定
+type ArchiveOptions struct {
+	Format       string // アーカイブ形式 (tar, tar.gz, zip)
+	Level        int    // 圧縮レベル
+	Reproducible bool   // エントリの整列・所有者と更新日時の固定を行う
+
+	// S3 はアーカイブの出力パスがS3のURLの場合のアップロード先
+	S3 *storage.S3Client
+}
+
+// NewArchiveOptions は設定からアーカイブ出力の設定を作成
+func NewArchiveOptions(cfg *config.Config) ArchiveOptions {
+	return ArchiveOptions{
+		Format:       cfg.GetArchiveFormat(),
+		Level:        cfg.CompressionLevel,
+		Reproducible: cfg.ReproducibleArchive,
+	}
+}
+
+// archiveWriter はアーカイブ形式ごとの書き込み処理を抽象化
+type archiveWriter interface {
+	// WriteEntry はエントリを書き込む（ディレクトリの場合rはnil）
+	WriteEntry(name string, info fs.FileInfo, r io.Reader) error
+	Close() error
+}
+
+// newArchiveWriter は形式に応じたアーカイブライターを作成
+func newArchiveWriter(w io.Writer, opts ArchiveOptions) (archiveWriter, error) {
+	switch opts.Format {
+	case config.ArchiveTar:
+		return &tarArchiveWriter{tw: tar.NewWriter(w), reproducible: opts.Reproducible}, nil
+	case config.ArchiveTarGz:
+		gw, err := gzip.NewWriterLevel(w, opts.Level)
+		if err != nil {
+			return nil, fmt.Errorf("gzipライターの作成に失敗: %v", err)
+		}
+		return &tarArchiveWriter{tw: tar.NewWriter(gw), gw: gw, reproducible: opts.Reproducible}, nil
+	case config.ArchiveZip:
+		zw := zip.NewWriter(w)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, opts.Level)
+		})
+		return &zipArchiveWriter{zw: zw, store: opts.Level == flate.NoCompression, reproducible: opts.Reproducible}, nil
+	default:
+		return nil, fmt.Errorf("未対応のアーカイブ形式: %s", opts.Format)
+	}
+}
+
+// reproducibleMode は再現可能モードで使用するパーミッションを返す
+func reproducibleMode(info fs.FileInfo) fs.FileMode {
+	if info.IsDir() {
+		return 0755
+	}
+	return 0644
+}
+
+// tarArchiveWriter はtar/tar.gz形式のライター
+type tarArchiveWriter struct {
+	tw           *tar.Writer
+	gw           *gzip.Writer // tar.gzの場合のみ
+	reproducible bool
+}
+
+// WriteEntry はtarエントリを書き込む
+func (w *tarArchiveWriter) WriteEntry(name string, info fs.FileInfo, r io.Reader) error {
+	var header *tar.Header
+	if w.reproducible {
+		// 所有者・更新日時を固定し、実行環境に依存しないヘッダーを作成
+		header = &tar.Header{
+			Typeflag: tar.TypeReg,
+			Size:     info.Size(),
+			Mode:     int64(reproducibleMode(info)),
+			ModTime:  reproducibleModTime,
+		}
+		if info.IsDir() {
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		}
+	} else {
+		var err error
+		header, err = tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	// ディレクトリの場合はファイル内容を書き込まない
+	if r == nil {
+		return nil
+	}
+
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+// Close はtar（とgzip）ストリームを閉じる
+func (w *tarArchiveWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.gw != nil {
+		return w.gw.Close()
+	}
+	return nil
+}
+
+// zipArchiveWriter はzip形式のライター
+type zipArchiveWriter struct {
+	zw           *zip.Writer
+	store        bool // 圧縮レベル0の場合は無圧縮で格納
+	reproducible bool
+}
+
+// WriteEntry はzipエントリを書き込む
+func (w *zipArchiveWriter) WriteEntry(name string, info fs.FileInfo, r io.Reader) error {
+	var header *zip.FileHeader
+	if w.reproducible {
+		header = &zip.FileHeader{Modified: reproducibleModTime}
+		header.SetMode(reproducibleMode(info))
+	} else {
+		var err error
+		header, err = zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	} else if w.store {
+		header.Method = zip.Store
+	} else {
+		header.Method = zip.Deflate
+	}
+
+	entry, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// ディレクトリの場合はファイル内容を書き込まない
+	if r == nil {
+		return nil
+	}
+
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+// Close はzipストリームを閉じる
+func (w *zipArchiveWriter) Close() error {
+	return w.zw.Close()
+}
+
+// archiveFile はアーカイブファイルとそのチェックサム計算をまとめて扱う
+// 出力パスがS3のURLの場合は一時ファイルへ書き込み、確定時にアップロードする
+type archiveFile struct {
+	path   string
+	file   *os.File
+	hash   hash.Hash
+	opts   ArchiveOptions
+	writer archiveWriter
+}
+
+// createArchiveFile はアーカイブファイルを作成
+func createArchiveFile(archivePath string, opts ArchiveOptions) (*archiveFile, error) {
+	var file *os.File
+	var err error
+	if storage.IsS3URL(archivePath) {
+		if opts.S3 == nil {
+			return nil, fmt.Errorf("S3クライアントが設定されていません: %s", archivePath)
+		}
+		file, err = os.CreateTemp("", "dataset-archive-*")
+	} else {
+		if dir := filepath.Dir(archivePath); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, fmt.Errorf("アーカイブ出力先ディレクトリの作成に失敗: %v", err)
+			}
+		}
+		file, err = os.Create(archivePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("アーカイブファイルの作成に失敗: %v", err)
+	}
+
+	hasher := sha256.New()
+	writer, err := newArchiveWriter(io.MultiWriter(file, hasher), opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &archiveFile{path: archivePath, file: file, hash: hasher, opts: opts, writer: writer}, nil
+}
+
+// Close はアーカイブを確定させ、再現可能モードではチェックサムファイルを書き出す
+func (a *archiveFile) Close() error {
+	if err := a.writer.Close(); err != nil {
+		a.file.Close()
+		a.removeTemp()
+		return fmt.Errorf("アーカイブの書き込みに失敗: %v", err)
+	}
+	if err := a.file.Close(); err != nil {
+		a.removeTemp()
+		return fmt.Errorf("アーカイブファイルのクローズに失敗: %v", err)
+	}
+
+	if storage.IsS3URL(a.path) {
+		if err := a.upload(); err != nil {
+			return fmt.Errorf("アーカイブのアップロードに失敗: %v", err)
+		}
+	}
+
+	sum := hex.EncodeToString(a.hash.Sum(nil))
+	log.Printf("アーカイブが作成されました: %s (sha256: %s)", a.path, sum)
+
+	if a.opts.Reproducible {
+		// sha256sum互換の形式で出力
+		line := []byte(fmt.Sprintf("%s  %s\n", sum, path.Base(filepath.ToSlash(a.path))))
+		if err := a.writeSidecar(a.path+".sha256", line); err != nil {
+			return fmt.Errorf("チェックサムファイルの書き込みに失敗: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeTemp はS3へアップロードするための一時ファイルを削除
+func (a *archiveFile) removeTemp() {
+	if storage.IsS3URL(a.path) {
+		os.Remove(a.file.Name())
+	}
+}
+
+// upload は一時ファイルに書き込んだアーカイブをS3へアップロードし、一時ファイルを削除
+func (a *archiveFile) upload() error {
+	defer a.removeTemp()
+
+	bucket, key, err := storage.ParseS3URL(a.path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(a.file.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return a.opts.S3.Upload(bucket, key, file)
+}
+
+// writeSidecar はアーカイブに付随するファイルを書き込む（S3の場合はオブジェクトとして書き込む）
+func (a *archiveFile) writeSidecar(p string, data []byte) error {
+	if storage.IsS3URL(p) {
+		bucket, key, err := storage.ParseS3URL(p)
+		if err != nil {
+			return err
+		}
+		return a.opts.S3.PutObject(bucket, key, data)
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// archiveSourceEntry はアーカイブ化するエントリ
+type archiveSourceEntry struct {
+	fsys fs.FS
+	path string
+	name string
+	info fs.FileInfo
+}
+
+// sortArchiveEntries はエントリ名で整列する
+func sortArchiveEntries(entries []archiveSourceEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+}
+
+// CreateArchives は出力ディレクトリのアーカイブを作成
+// splitsが指定された場合は分割ごとに個別のアーカイブを作成する
+func CreateArchives(cfg *config.Config, opts ArchiveOptions, splits []string) error {
+	if !cfg.ArchivePerSplit {
+		return CreateArchive(cfg.DestDir, "", cfg.GetArchivePath(""), opts)
+	}
+
+	for _, split := range splits {
+		if _, err := os.Stat(filepath.Join(cfg.DestDir, split)); os.IsNotExist(err) {
+			continue
+		}
+		if err := CreateArchive(cfg.DestDir, split, cfg.GetArchivePath(split), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateArchive は指定形式のアーカイブを作成
+// subDirが空でなければsourceDir/subDir以下と、sourceDir直下のファイルを対象とする（エントリ名はsourceDirからの相対パス）
+func CreateArchive(sourceDir, subDir, archivePath string, opts ArchiveOptions) error {
+	log.Printf("アーカイブの作成を開始: %s", archivePath)
+
+	fsys := os.DirFS(sourceDir)
+	walkRoot := "."
+	if subDir != "" {
+		walkRoot = filepath.ToSlash(subDir)
+	}
+
+	// ディレクトリ内のエントリを再帰的に収集
+	var entries []archiveSourceEntry
+	err := fs.WalkDir(fsys, walkRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// ソースディレクトリ自体はスキップ
+		if p == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, archiveSourceEntry{fsys: fsys, path: p, name: p, info: info})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ファイル一覧の取得に失敗: %v", err)
+	}
+
+	// 分割ごとのアーカイブには出力先直下のファイル（classes.txt・リストファイル・一覧など）も含める
+	// （直接出力時の SplitArchiveSink と同じ内容にする）
+	if subDir != "" {
+		rootEntries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return fmt.Errorf("ファイル一覧の取得に失敗: %v", err)
+		}
+		for _, d := range rootEntries {
+			if d.IsDir() {
+				continue
+			}
+			info, err := d.Info()
+			if err != nil {
+				return fmt.Errorf("ファイル一覧の取得に失敗: %v", err)
+			}
+			entries = append(entries, archiveSourceEntry{fsys: fsys, path: d.Name(), name: d.Name(), info: info})
+		}
+	}
+
+	if opts.Reproducible {
+		sortArchiveEntries(entries)
+	}
+
+	archive, err := createArchiveFile(archivePath, opts)
+	if err != nil {
+		return err
+	}
+
+	// エントリをアーカイブに追加
+	for _, entry := range entries {
+		if err := writeArchiveEntry(archive.writer, entry); err != nil {
+			archive.Close()
+			return fmt.Errorf("ファイルのアーカイブ化に失敗: %v", err)
+		}
+	}
+
+	return archive.Close()
+}
+
+// writeArchiveEntry はエントリをアーカイブへ書き込む
+func writeArchiveEntry(writer archiveWriter, entry archiveSourceEntry) error {
+	// ディレクトリの場合はファイル内容を書き込まない
+	if entry.info.IsDir() {
+		return writer.WriteEntry(entry.name, entry.info, nil)
+	}
+
+	file, err := entry.fsys.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writer.WriteEntry(entry.name, entry.info, file)
+}
+
+// splitOf はアーカイブ内パスの先頭要素（分割名）を返す
+func splitOf(name string) string {
+	return strings.SplitN(path.Clean(name), "/", 2)[0]
+}
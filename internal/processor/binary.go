@@ -6,47 +6,38 @@ import (
 	"math/rand"
 
 	"dataset-splitter/internal/config"
-	"dataset-splitter/internal/utils"
+	"dataset-splitter/internal/dataset"
 )
 
-// ProcessBinaryClassification は二値分類処理
-func ProcessBinaryClassification(config *config.Config, classDirs []string) error {
+// PlanBinaryClassification は二値分類の分割結果（positive / negative）を作成
+func PlanBinaryClassification(config *config.Config, classes []*dataset.Class) ([]*SplitPlan, error) {
 	// positiveクラスのデータを収集
-	var positiveFiles []string
-	var allOtherFiles []string
+	var positiveFiles []*dataset.File
+	var allOtherFiles []*dataset.File
 
 	log.Printf("positiveクラス '%s' のデータを収集中...", config.PositiveClass)
 	log.Printf("二値分類モード: 最小ファイル数制限を無効化（全サブクラスからデータを取得）")
 
-	// 全クラスディレクトリを走査してpositiveクラスとその他のデータを分類
-	for _, classDir := range classDirs {
-		className := utils.GetClassName(classDir)
+	// 全クラスを走査してpositiveクラスとその他のデータを分類
+	for _, class := range classes {
+		className := class.Name
 		log.Printf("クラス '%s' を処理中...", className)
 
-		// サブディレクトリを取得
-		subDirs, err := utils.GetSubDirectories(classDir)
-		if err != nil {
-			log.Printf("警告: クラス %s のサブディレクトリ取得に失敗: %v", className, err)
-			continue
-		}
-
 		// 各サブクラスから均等にデータを取得
-		var classFiles []string
-		for _, subDir := range subDirs {
-			subDirName := utils.GetClassName(subDir)
+		var classFiles []*dataset.File
+		for _, sub := range class.Subclasses {
+			subDirName := sub.Name
 			log.Printf("  サブディレクトリ '%s' を処理中...", subDirName)
 
-			// 画像ファイルを取得
-			files, err := utils.GetImageFiles(subDir)
-			if err != nil {
-				log.Printf("    警告: ファイル一覧の取得に失敗: %v", err)
-				continue
+			if summary := sub.SkippedSummary(); summary != "" {
+				log.Printf("    除外: %s", summary)
 			}
 
-			if len(files) == 0 {
+			if len(sub.Files) == 0 {
 				log.Printf("    警告: サブディレクトリ '%s' に画像ファイルがありません", subDirName)
 				continue
 			}
+			files := append([]*dataset.File(nil), sub.Files...)
 
 			log.Printf("    ファイル数: %d", len(files))
 
@@ -86,7 +77,7 @@ func ProcessBinaryClassification(config *config.Config, classDirs []string) erro
 	log.Printf("negativeクラス: %d件", len(allOtherFiles))
 
 	if len(positiveFiles) == 0 {
-		return fmt.Errorf("positiveクラス '%s' のデータが見つかりません", config.PositiveClass)
+		return nil, fmt.Errorf("positiveクラス '%s' のデータが見つかりません", config.PositiveClass)
 	}
 
 	// 少ない方のデータ数を基準に設定
@@ -105,37 +96,16 @@ func ProcessBinaryClassification(config *config.Config, classDirs []string) erro
 		allOtherFiles[i], allOtherFiles[j] = allOtherFiles[j], allOtherFiles[i]
 	})
 
-	// 分割点の計算
-	trainingCount := int(float64(targetCount) * config.TrainingRatio)
-
 	// 教師データと検証データに分割
-	positiveTraining := positiveFiles[:trainingCount]
-	positiveValidation := positiveFiles[trainingCount:targetCount]
-	negativeTraining := allOtherFiles[:trainingCount]
-	negativeValidation := allOtherFiles[trainingCount:targetCount]
-
-	// ディレクトリの作成とファイルのコピー
-	log.Printf("positive/negativeデータのコピーを開始...")
-
-	// positiveクラスのコピー
-	if err := CopyFilesParallel(config.DestDir, "train", "positive", positiveTraining, config.MaxCopyWorkers); err != nil {
-		return fmt.Errorf("positive教師データのコピーに失敗: %v", err)
-	}
-	if err := CopyFilesParallel(config.DestDir, "validation", "positive", positiveValidation, config.MaxCopyWorkers); err != nil {
-		return fmt.Errorf("positive検証データのコピーに失敗: %v", err)
-	}
-
-	// negativeクラスのコピー
-	if err := CopyFilesParallel(config.DestDir, "train", "negative", negativeTraining, config.MaxCopyWorkers); err != nil {
-		return fmt.Errorf("negative教師データのコピーに失敗: %v", err)
-	}
-	if err := CopyFilesParallel(config.DestDir, "validation", "negative", negativeValidation, config.MaxCopyWorkers); err != nil {
-		return fmt.Errorf("negative検証データのコピーに失敗: %v", err)
-	}
+	positiveTraining, positiveValidation := SplitFiles(positiveFiles[:targetCount], config.TrainingRatio)
+	negativeTraining, negativeValidation := SplitFiles(allOtherFiles[:targetCount], config.TrainingRatio)
 
-	log.Printf("二値分類データセットの作成が完了しました！")
+	log.Printf("二値分類データセットの分割が完了しました！")
 	log.Printf("  教師データ: positive %d件, negative %d件", len(positiveTraining), len(negativeTraining))
 	log.Printf("  検証データ: positive %d件, negative %d件", len(positiveValidation), len(negativeValidation))
 
-	return nil
+	return []*SplitPlan{
+		{Name: "positive", Train: positiveTraining, Validation: positiveValidation},
+		{Name: "negative", Train: negativeTraining, Validation: negativeValidation},
+	}, nil
 }
@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"strings"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+)
+
+// ColorModesFileName は8ビットRGB以外の画像の一覧を出力するファイル名
+const ColorModesFileName = "color_modes.txt"
+
+// 画像の色モード（ヘッダーの色モデルから判定）
+const (
+	ColorModeRGB     = "rgb"     // 8ビットRGB
+	ColorModeRGBA    = "rgba"    // 8ビットRGB（またはグレースケール）と透過
+	ColorModeGray    = "gray"    // 8ビットグレースケール
+	ColorModeGray16  = "gray16"  // 16ビットグレースケール
+	ColorModeRGB16   = "rgb16"   // 16ビットRGB
+	ColorModeRGBA16  = "rgba16"  // 16ビットRGBと透過
+	ColorModeCMYK    = "cmyk"    // CMYK
+	ColorModePalette = "palette" // パレット（GIF, インデックスカラーのPNG）
+)
+
+// colorModeName は色モデルから色モードを返す（判定できない場合は空文字）
+func colorModeName(model color.Model) string {
+	if _, ok := model.(color.Palette); ok {
+		return ColorModePalette
+	}
+	switch model {
+	case color.YCbCrModel, color.RGBAModel:
+		return ColorModeRGB
+	case color.NRGBAModel:
+		return ColorModeRGBA
+	case color.GrayModel:
+		return ColorModeGray
+	case color.Gray16Model:
+		return ColorModeGray16
+	case color.RGBA64Model:
+		return ColorModeRGB16
+	case color.NRGBA64Model:
+		return ColorModeRGBA16
+	case color.CMYKModel:
+		return ColorModeCMYK
+	}
+	return ""
+}
+
+// needsRGBConversion は色モードを読み込めた画像が8ビットRGB以外かどうかを返す
+func needsRGBConversion(file *dataset.File) bool {
+	return file.ColorMode != "" && file.ColorMode != ColorModeRGB
+}
+
+// CheckColorModes は画像の色モードを読み込み、8ビットRGB以外の画像の件数をサブクラスごとに表示する
+// policyが config.ColorCheckExclude の場合は該当する画像をサブクラスから除外する
+// 8ビットRGB以外の画像を返す（標準ライブラリでデコードできない形式は確認しない）
+func CheckColorModes(classes []*dataset.Class, policy string, maxWorkers int) []*dataset.File {
+	log.Printf("色モードの検査を開始...")
+	ReadDimensions(classes, maxWorkers)
+
+	var found []*dataset.File
+	removed := make(map[*dataset.File]bool)
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			counts := make(map[string]int)
+			for _, file := range sub.Files {
+				if !needsRGBConversion(file) {
+					continue
+				}
+				counts[file.ColorMode]++
+				found = append(found, file)
+				if policy == config.ColorCheckExclude {
+					removed[file] = true
+				}
+			}
+			if len(counts) > 0 {
+				log.Printf("  %s/%s: %s（%d件中）", class.Name, sub.Name, formatCounts(counts, nil), len(sub.Files))
+			}
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		log.Printf("  8ビットRGB以外の画像はありません")
+	case policy == config.ColorCheckExclude:
+		removeFiles(classes, removed, dataset.SkipColorMode)
+		log.Printf("  8ビットRGB以外の画像を除外: %d件", len(found))
+	case policy == config.ColorCheckConvert:
+		log.Printf("  8ビットRGB以外の画像をコピー時に変換: %d件", len(found))
+	default:
+		log.Printf("  8ビットRGB以外の画像: %d件", len(found))
+	}
+	return found
+}
+
+// WriteColorModeReport は8ビットRGB以外の画像の一覧を出力先のルートに書き込む
+// 各行は「クラス/サブクラス<TAB>パス<TAB>色モード」
+func WriteColorModeReport(sink Sink, files []*dataset.File) error {
+	var report strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&report, "%s/%s\t%s\t%s\n", file.Class, file.Subclass, file.Path, file.ColorMode)
+	}
+
+	if err := sink.WriteFile(ColorModesFileName, []byte(report.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", ColorModesFileName, err)
+	}
+	log.Printf("8ビットRGB以外の画像の一覧を出力しました: %s (%d件)", ColorModesFileName, len(files))
+	return nil
+}
@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+)
+
+// LabelConflictsFileName はラベルの矛盾の一覧を出力するファイル名
+const LabelConflictsFileName = "label_conflicts.txt"
+
+// LabelConflict は内容が同じで異なるラベル（クラス/サブクラス）に属するファイルの組
+type LabelConflict struct {
+	Hash    string
+	Labels  []string        // 組に含まれるラベル（データセット内の順序）
+	Kept    string          // 残したラベル（すべて除外・報告のみの場合は空）
+	Files   []*dataset.File // データセット内の順序（クラス名・サブクラス名順）
+	Dropped []bool          // Filesと同じ順序で、除外したかどうか
+}
+
+// fileLabel はファイルのラベル（クラス/サブクラス）を返す
+func fileLabel(file *dataset.File) string {
+	return file.Class + "/" + file.Subclass
+}
+
+// ResolveLabelConflicts は内容が同じファイルが異なるラベルに属する組を検出し、方針に従って除外する
+// config.ConflictReport は除外せず一覧のみ、config.ConflictDropAll は組のファイルをすべて除外する
+// config.ConflictKeepFirst は最初のラベル、config.ConflictMajority は最も多くのファイルがあるラベル（同数なら先のラベル）のみを残す
+// 同じラベル内の重複はラベルの矛盾として扱わない（-dedup で扱う）
+func ResolveLabelConflicts(classes []*dataset.Class, policy string, maxWorkers int) ([]LabelConflict, error) {
+	if err := HashFiles(classes, maxWorkers); err != nil {
+		return nil, err
+	}
+
+	var conflicts []LabelConflict
+	dropped := make(map[*dataset.File]bool)
+	for _, files := range sameContentFiles(classes) {
+		counts := make(map[string]int)
+		var labels []string
+		for _, file := range files {
+			label := fileLabel(file)
+			if counts[label] == 0 {
+				labels = append(labels, label)
+			}
+			counts[label]++
+		}
+		if len(labels) < 2 {
+			continue
+		}
+
+		conflict := LabelConflict{
+			Hash:    files[0].SHA256,
+			Labels:  labels,
+			Files:   files,
+			Dropped: make([]bool, len(files)),
+		}
+		switch policy {
+		case config.ConflictKeepFirst:
+			conflict.Kept = labels[0]
+		case config.ConflictMajority:
+			conflict.Kept = labels[0]
+			for _, label := range labels[1:] {
+				if counts[label] > counts[conflict.Kept] {
+					conflict.Kept = label
+				}
+			}
+		}
+		if policy != config.ConflictReport {
+			for i, file := range files {
+				if fileLabel(file) != conflict.Kept {
+					conflict.Dropped[i] = true
+					dropped[file] = true
+				}
+			}
+		}
+		conflicts = append(conflicts, conflict)
+	}
+
+	if len(conflicts) == 0 {
+		log.Printf("ラベルの矛盾はありません")
+		return nil, nil
+	}
+
+	log.Printf("ラベルの矛盾（内容が同じで異なるラベルのファイル）: %d組", len(conflicts))
+	for _, conflict := range conflicts {
+		paths := make([]string, len(conflict.Files))
+		for i, file := range conflict.Files {
+			paths[i] = file.Path
+		}
+		resolution := "報告のみ"
+		switch {
+		case conflict.Kept != "":
+			resolution = "'" + conflict.Kept + "' に残す"
+		case policy == config.ConflictDropAll:
+			resolution = "すべて除外"
+		}
+		log.Printf("  %s: %s (%s)", strings.Join(conflict.Labels, ", "), strings.Join(paths, ", "), resolution)
+	}
+
+	if len(dropped) > 0 {
+		removeFiles(classes, dropped, dataset.SkipLabelConflict)
+		log.Printf("ラベルの矛盾により除外したファイル: %d件", len(dropped))
+	}
+	return conflicts, nil
+}
+
+// WriteLabelConflictReport はラベルの矛盾の一覧を出力
+// 1行1ファイルで「SHA-256<TAB>クラス/サブクラス<TAB>ソース内のパス<TAB>kept|dropped」の形式とする
+func WriteLabelConflictReport(sink Sink, conflicts []LabelConflict) error {
+	var report strings.Builder
+	for _, conflict := range conflicts {
+		for i, file := range conflict.Files {
+			status := "kept"
+			if conflict.Dropped[i] {
+				status = "dropped"
+			}
+			fmt.Fprintf(&report, "%s\t%s\t%s\t%s\n", conflict.Hash, fileLabel(file), file.Path, status)
+		}
+	}
+
+	if err := sink.WriteFile(LabelConflictsFileName, []byte(report.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", LabelConflictsFileName, err)
+	}
+	log.Printf("ラベルの矛盾の一覧を出力しました: %s (%d組)", LabelConflictsFileName, len(conflicts))
+	return nil
+}
@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+)
+
+// TestResolveLabelConflicts は内容が同じで異なるラベルに属するファイルの組の検出と、方針ごとの除外を確認する
+func TestResolveLabelConflicts(t *testing.T) {
+	fsys := fstest.MapFS{
+		// x: A/A1 に1件、B/B1 に2件
+		"A/A1/x1.jpg": {Data: []byte("x")},
+		"B/B1/x2.jpg": {Data: []byte("x")},
+		"B/B1/x3.jpg": {Data: []byte("x")},
+		// y: A/A2 と B/B1 に1件ずつ（同数）
+		"A/A2/y1.jpg": {Data: []byte("y")},
+		"B/B1/y2.jpg": {Data: []byte("y")},
+		// z: 同じラベル内の重複は矛盾としない
+		"A/A1/z1.jpg": {Data: []byte("z")},
+		"A/A1/z2.jpg": {Data: []byte("z")},
+		"A/A1/u.jpg":  {Data: []byte("unique")},
+	}
+	all := []string{"A/A1/u.jpg", "A/A1/x1.jpg", "A/A1/z1.jpg", "A/A1/z2.jpg", "A/A2/y1.jpg", "B/B1/x2.jpg", "B/B1/x3.jpg", "B/B1/y2.jpg"}
+
+	tests := []struct {
+		policy      string
+		wantKept    []string // 組ごとの残したラベル（x, y の順）
+		wantFiles   []string
+		wantSkipped map[string]int
+	}{
+		{
+			policy:      config.ConflictReport,
+			wantKept:    []string{"", ""},
+			wantFiles:   all,
+			wantSkipped: map[string]int{},
+		},
+		{
+			policy:      config.ConflictDropAll,
+			wantKept:    []string{"", ""},
+			wantFiles:   []string{"A/A1/u.jpg", "A/A1/z1.jpg", "A/A1/z2.jpg"},
+			wantSkipped: map[string]int{"A/A1": 1, "A/A2": 1, "B/B1": 3},
+		},
+		{
+			policy:      config.ConflictKeepFirst,
+			wantKept:    []string{"A/A1", "A/A2"},
+			wantFiles:   []string{"A/A1/u.jpg", "A/A1/x1.jpg", "A/A1/z1.jpg", "A/A1/z2.jpg", "A/A2/y1.jpg"},
+			wantSkipped: map[string]int{"B/B1": 3},
+		},
+		{
+			policy:      config.ConflictMajority,
+			wantKept:    []string{"B/B1", "A/A2"}, // 同数なら先のラベル
+			wantFiles:   []string{"A/A1/u.jpg", "A/A1/z1.jpg", "A/A1/z2.jpg", "A/A2/y1.jpg", "B/B1/x2.jpg", "B/B1/x3.jpg"},
+			wantSkipped: map[string]int{"A/A1": 1, "B/B1": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			classes := testClasses(fsys)
+			conflicts, err := ResolveLabelConflicts(classes, tt.policy, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(conflicts) != 2 {
+				t.Fatalf("組の数 = %d, want 2", len(conflicts))
+			}
+			wantLabels := [][]string{{"A/A1", "B/B1"}, {"A/A2", "B/B1"}}
+			for i, conflict := range conflicts {
+				if !slices.Equal(conflict.Labels, wantLabels[i]) {
+					t.Errorf("組%d のラベル = %v, want %v", i, conflict.Labels, wantLabels[i])
+				}
+				if conflict.Kept != tt.wantKept[i] {
+					t.Errorf("組%d の残したラベル = %q, want %q", i, conflict.Kept, tt.wantKept[i])
+				}
+				for j, file := range conflict.Files {
+					wantDropped := tt.policy != config.ConflictReport && fileLabel(file) != conflict.Kept
+					if conflict.Dropped[j] != wantDropped {
+						t.Errorf("組%d の %s: 除外 = %t, want %t", i, file.Path, conflict.Dropped[j], wantDropped)
+					}
+				}
+			}
+
+			if got := remainingFiles(classes); !slices.Equal(got, tt.wantFiles) {
+				t.Errorf("残ったファイル = %v, want %v", got, tt.wantFiles)
+			}
+			got := skippedCounts(classes, dataset.SkipLabelConflict)
+			if len(got) != len(tt.wantSkipped) {
+				t.Errorf("ラベルの矛盾の件数 = %v, want %v", got, tt.wantSkipped)
+			}
+			for key, n := range tt.wantSkipped {
+				if got[key] != n {
+					t.Errorf("%s のラベルの矛盾の件数 = %d, want %d", key, got[key], n)
+				}
+			}
+		})
+	}
+}
+
+// TestResolveLabelConflictsBeforeDedup はラベルの矛盾を処理した後の重複の検出で、残ったファイルのみが対象になることを確認する
+func TestResolveLabelConflictsBeforeDedup(t *testing.T) {
+	classes := testClasses(fstest.MapFS{
+		"A/A1/a.jpg": {Data: []byte("x")},
+		"A/A1/b.jpg": {Data: []byte("x")},
+		"B/B1/c.jpg": {Data: []byte("x")},
+	})
+	if _, err := ResolveLabelConflicts(classes, config.ConflictMajority, 2); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := RemoveDuplicates(classes, config.DedupKeepFirst, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].Scope != ScopeSubclass {
+		t.Fatalf("重複の組 = %+v, want サブクラス内の1組", groups)
+	}
+	if got := remainingFiles(classes); !slices.Equal(got, []string{"A/A1/a.jpg"}) {
+		t.Errorf("残ったファイル = %v", got)
+	}
+}
+
+// TestWriteLabelConflictReport はラベルの矛盾の一覧の形式を確認する
+func TestWriteLabelConflictReport(t *testing.T) {
+	classes := testClasses(fstest.MapFS{
+		"A/A1/a.jpg": {Data: []byte("x")},
+		"B/B1/b.jpg": {Data: []byte("x")},
+	})
+	conflicts, err := ResolveLabelConflicts(classes, config.ConflictKeepFirst, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := WriteLabelConflictReport(NewDirSink(dir), conflicts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, LabelConflictsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := conflicts[0].Hash
+	want := hash + "\tA/A1\tA/A1/a.jpg\tkept\n" + hash + "\tB/B1\tB/B1/b.jpg\tdropped\n"
+	if string(got) != want {
+		t.Errorf("一覧 = %q, want %q", got, want)
+	}
+}
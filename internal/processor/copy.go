@@ -5,15 +5,16 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"path"
 	"sync"
 
+	"dataset-splitter/internal/dataset"
 	"dataset-splitter/internal/utils"
 )
 
 // CopyFile は単一ファイルをコピー
-func CopyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
+func CopyFile(src *dataset.File, dst string) error {
+	srcFile, err := src.Open()
 	if err != nil {
 		return err
 	}
@@ -30,20 +31,20 @@ func CopyFile(src, dst string) error {
 }
 
 // CopyFiles はファイル群を順次コピー
-func CopyFiles(destRoot, splitType, subDirName string, files []string) error {
+func CopyFiles(sink Sink, splitType, subDirName string, files []*dataset.File) error {
 	// 出力ディレクトリの作成
-	destDir := filepath.Join(destRoot, splitType, subDirName)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	destDir := path.Join(splitType, subDirName)
+	if err := sink.MkdirAll(destDir); err != nil {
 		return fmt.Errorf("ディレクトリの作成に失敗: %v", err)
 	}
 
 	// ファイルのコピー
-	for _, srcPath := range files {
-		fileName := filepath.Base(srcPath)
-		destPath := filepath.Join(destDir, fileName)
+	for _, file := range files {
+		fileName := file.OutputName()
+		destPath := path.Join(destDir, fileName)
 
-		if err := CopyFile(srcPath, destPath); err != nil {
-			log.Printf("警告: ファイルのコピーに失敗 %s -> %s: %v", srcPath, destPath, err)
+		if err := sink.CopyFile(file, destPath); err != nil {
+			log.Printf("警告: ファイルのコピーに失敗 %s -> %s: %v", file.Path, destPath, err)
 			continue
 		}
 	}
@@ -52,19 +53,19 @@ func CopyFiles(destRoot, splitType, subDirName string, files []string) error {
 }
 
 // CopyFilesParallel はファイル群を並列コピー
-func CopyFilesParallel(destRoot, splitType, subDirName string, files []string, maxWorkers int) error {
+func CopyFilesParallel(sink Sink, splitType, subDirName string, files []*dataset.File, maxWorkers int) error {
 	if len(files) == 0 {
 		return nil
 	}
 
 	// 並列度が1の場合は順次処理
 	if maxWorkers <= 1 {
-		return CopyFiles(destRoot, splitType, subDirName, files)
+		return CopyFiles(sink, splitType, subDirName, files)
 	}
 
 	// 出力ディレクトリの作成
-	destDir := filepath.Join(destRoot, splitType, subDirName)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	destDir := path.Join(splitType, subDirName)
+	if err := sink.MkdirAll(destDir); err != nil {
 		return fmt.Errorf("ディレクトリの作成に失敗: %v", err)
 	}
 
@@ -73,20 +74,20 @@ func CopyFilesParallel(destRoot, splitType, subDirName string, files []string, m
 	var wg sync.WaitGroup
 	errors := make(chan error, len(files))
 
-	for _, srcPath := range files {
+	for _, file := range files {
 		wg.Add(1)
-		go func(src string) {
+		go func(src *dataset.File) {
 			defer wg.Done()
 			sem.Acquire()
 			defer sem.Release()
 
-			fileName := filepath.Base(src)
-			destPath := filepath.Join(destDir, fileName)
+			fileName := src.OutputName()
+			destPath := path.Join(destDir, fileName)
 
-			if err := CopyFile(src, destPath); err != nil {
-				errors <- fmt.Errorf("ファイルのコピーに失敗 %s -> %s: %v", src, destPath, err)
+			if err := sink.CopyFile(src, destPath); err != nil {
+				errors <- fmt.Errorf("ファイルのコピーに失敗 %s -> %s: %v", src.Path, destPath, err)
 			}
-		}(srcPath)
+		}(file)
 	}
 
 	wg.Wait()
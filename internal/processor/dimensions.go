@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"log"
+	"path"
+	"sync"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// DimensionLimits は解像度・縦横比による除外条件（0は制限なし）
+type DimensionLimits struct {
+	MinWidth  int
+	MaxWidth  int
+	MinHeight int
+	MaxHeight int
+	MinAspect float64 // 縦横比（幅÷高さ）の下限
+	MaxAspect float64 // 縦横比（幅÷高さ）の上限
+}
+
+// NewDimensionLimits は設定から解像度・縦横比による除外条件を作成
+func NewDimensionLimits(cfg *config.Config) DimensionLimits {
+	return DimensionLimits{
+		MinWidth:  cfg.MinWidth,
+		MaxWidth:  cfg.MaxWidth,
+		MinHeight: cfg.MinHeight,
+		MaxHeight: cfg.MaxHeight,
+		MinAspect: cfg.MinAspect,
+		MaxAspect: cfg.MaxAspect,
+	}
+}
+
+// Enabled は除外条件が1つでも指定されているかを返す
+func (l DimensionLimits) Enabled() bool {
+	return l != DimensionLimits{}
+}
+
+// String は除外条件をログ出力用の文字列で返す
+func (l DimensionLimits) String() string {
+	return fmt.Sprintf("幅 %s, 高さ %s, 縦横比 %s",
+		formatRange(float64(l.MinWidth), float64(l.MaxWidth)),
+		formatRange(float64(l.MinHeight), float64(l.MaxHeight)),
+		formatRange(l.MinAspect, l.MaxAspect))
+}
+
+// formatRange は下限・上限（0は制限なし）を「下限〜上限」の形式で返す
+func formatRange(lower, upper float64) string {
+	if lower == 0 && upper == 0 {
+		return "制限なし"
+	}
+	s := ""
+	if lower > 0 {
+		s = fmt.Sprintf("%g", lower)
+	}
+	s += "〜"
+	if upper > 0 {
+		s += fmt.Sprintf("%g", upper)
+	}
+	return s
+}
+
+// check は画像の幅・高さが条件を満たさない場合に除外理由を返す（満たす場合は空文字）
+func (l DimensionLimits) check(width, height int) string {
+	if (l.MinWidth > 0 && width < l.MinWidth) || (l.MaxWidth > 0 && width > l.MaxWidth) ||
+		(l.MinHeight > 0 && height < l.MinHeight) || (l.MaxHeight > 0 && height > l.MaxHeight) {
+		return dataset.SkipResolution
+	}
+	if l.MinAspect > 0 || l.MaxAspect > 0 {
+		if height == 0 {
+			return dataset.SkipAspect
+		}
+		aspect := float64(width) / float64(height)
+		if (l.MinAspect > 0 && aspect < l.MinAspect) || (l.MaxAspect > 0 && aspect > l.MaxAspect) {
+			return dataset.SkipAspect
+		}
+	}
+	return ""
+}
+
+// ReadDimensions は画像のヘッダーを読み込み、File.Width, File.Height, File.ColorMode を設定する
+// 読み込み済みのファイルと標準ライブラリでデコードできない形式は読み込まない
+// 読み込めたファイル数を返す
+func ReadDimensions(classes []*dataset.Class, maxWorkers int) int {
+	var files []*dataset.File
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			for _, file := range sub.Files {
+				if file.Width == 0 && decodableKinds[utils.ExpectedKind(path.Ext(file.OutputName()))] {
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	if len(files) == 0 {
+		return 0
+	}
+	log.Printf("画像の解像度を読み込み中: %d件", len(files))
+
+	read := make([]bool, len(files))
+	sem := utils.NewSemaphore(max(maxWorkers, 1))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file *dataset.File) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			if err := readDimensions(file); err != nil {
+				log.Printf("警告: 画像の解像度を読み込めません: %s: %v", file.Path, err)
+				return
+			}
+			read[i] = true
+		}(i, file)
+	}
+	wg.Wait()
+
+	count := 0
+	for _, ok := range read {
+		if ok {
+			count++
+		}
+	}
+	return count
+}
+
+// readDimensions は画像のヘッダーから幅・高さ・色モードを読み込む
+func readDimensions(file *dataset.File) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	file.Width, file.Height = cfg.Width, cfg.Height
+	file.ColorMode = colorModeName(cfg.ColorModel)
+	return nil
+}
+
+// FilterByDimensions は解像度・縦横比が条件を満たさない画像をサブクラスから除外し、除外した件数を返す
+// 解像度を読み込めなかったファイル（デコードできない形式・壊れたファイル）は除外せずに残す
+func FilterByDimensions(classes []*dataset.Class, limits DimensionLimits, maxWorkers int) int {
+	log.Printf("解像度・縦横比による除外: %s", limits)
+	ReadDimensions(classes, maxWorkers)
+
+	counts := make(map[string]int)
+	unknown := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			files := make([]*dataset.File, 0, len(sub.Files))
+			for _, file := range sub.Files {
+				if file.Width == 0 {
+					unknown++
+					files = append(files, file)
+					continue
+				}
+				if reason := limits.check(file.Width, file.Height); reason != "" {
+					sub.AddSkipped(reason, 1)
+					counts[reason]++
+					continue
+				}
+				files = append(files, file)
+			}
+			sub.Files = files
+		}
+	}
+
+	if unknown > 0 {
+		log.Printf("  解像度が不明なため未確認: %d件", unknown)
+	}
+	for _, reason := range []string{dataset.SkipResolution, dataset.SkipAspect} {
+		if counts[reason] > 0 {
+			log.Printf("  %sにより除外: %d件", reason, counts[reason])
+		}
+	}
+	return counts[dataset.SkipResolution] + counts[dataset.SkipAspect]
+}
@@ -0,0 +1,221 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// DuplicatesFileName は重複ファイルの一覧を出力するファイル名
+const DuplicatesFileName = "duplicates.txt"
+
+// 重複の範囲
+const (
+	ScopeSubclass   = "サブクラス内"
+	ScopeSubclasses = "サブクラス間"
+	ScopeClasses    = "クラス間"
+)
+
+// DuplicateGroup は内容が同じファイルの組
+type DuplicateGroup struct {
+	Hash    string
+	Scope   string          // 重複の範囲（ScopeSubclass, ScopeSubclasses, ScopeClasses）
+	Files   []*dataset.File // データセット内の順序（クラス名・サブクラス名順）
+	Dropped []bool          // Filesと同じ順序で、除外したかどうか
+}
+
+// HashFiles は全ファイルの内容のSHA-256を計算して File.SHA256 に設定する
+// 計算済みのファイルは読み込まない
+func HashFiles(classes []*dataset.Class, maxWorkers int) error {
+	var files []*dataset.File
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			for _, file := range sub.Files {
+				if file.SHA256 == "" {
+					files = append(files, file)
+				}
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	log.Printf("ファイルのハッシュを計算中: %d件", len(files))
+
+	errs := make([]error, len(files))
+	sem := utils.NewSemaphore(max(maxWorkers, 1))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file *dataset.File) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			errs[i] = hashFile(file)
+		}(i, file)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%sのハッシュ計算に失敗: %v", files[i].Path, err)
+		}
+	}
+	return nil
+}
+
+// hashFile はファイルの内容のSHA-256を計算
+func hashFile(file *dataset.File) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return err
+	}
+	file.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return nil
+}
+
+// RemoveDuplicates は内容が同じファイルを検出し、方針に従って除外する
+// config.DedupKeepFirst は最初のファイルのみを残し、config.DedupDropAll は重複したファイルをすべて除外する
+// config.DedupError は重複があればエラーを返す
+func RemoveDuplicates(classes []*dataset.Class, policy string, maxWorkers int) ([]DuplicateGroup, error) {
+	if err := HashFiles(classes, maxWorkers); err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	dropped := make(map[*dataset.File]bool)
+	scopeCounts := make(map[string]int)
+	for _, files := range sameContentFiles(classes) {
+		group := DuplicateGroup{
+			Hash:    files[0].SHA256,
+			Scope:   duplicateScope(files),
+			Files:   files,
+			Dropped: make([]bool, len(files)),
+		}
+		for i, file := range group.Files {
+			if policy == config.DedupDropAll || (policy == config.DedupKeepFirst && i > 0) {
+				group.Dropped[i] = true
+				dropped[file] = true
+			}
+		}
+		scopeCounts[group.Scope]++
+		groups = append(groups, group)
+	}
+
+	if len(groups) == 0 {
+		log.Printf("重複ファイルはありません")
+		return nil, nil
+	}
+
+	for _, scope := range []string{ScopeSubclass, ScopeSubclasses, ScopeClasses} {
+		if scopeCounts[scope] > 0 {
+			log.Printf("重複ファイル（%s）: %d組", scope, scopeCounts[scope])
+		}
+	}
+	for _, group := range groups {
+		paths := make([]string, len(group.Files))
+		for i, file := range group.Files {
+			paths[i] = file.Path
+		}
+		log.Printf("  %s: %s", group.Scope, strings.Join(paths, ", "))
+	}
+
+	if policy == config.DedupError {
+		return groups, fmt.Errorf("重複ファイルが%d組見つかりました", len(groups))
+	}
+
+	removeFiles(classes, dropped, dataset.SkipDuplicate)
+	log.Printf("重複により除外したファイル: %d件", len(dropped))
+	return groups, nil
+}
+
+// sameContentFiles はSHA-256が同じファイルが2件以上ある組を返す（File.SHA256 は計算済みであること）
+// 組の順序・組内の順序はデータセット内の順序（クラス名・サブクラス名順）とする
+func sameContentFiles(classes []*dataset.Class) [][]*dataset.File {
+	byHash := make(map[string][]*dataset.File)
+	var order []string
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			for _, file := range sub.Files {
+				if _, ok := byHash[file.SHA256]; !ok {
+					order = append(order, file.SHA256)
+				}
+				byHash[file.SHA256] = append(byHash[file.SHA256], file)
+			}
+		}
+	}
+
+	var groups [][]*dataset.File
+	for _, hash := range order {
+		if len(byHash[hash]) >= 2 {
+			groups = append(groups, byHash[hash])
+		}
+	}
+	return groups
+}
+
+// removeFiles は指定したファイルをサブクラスから取り除き、除外理由ごとの件数に記録する
+func removeFiles(classes []*dataset.Class, removed map[*dataset.File]bool, reason string) {
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			files := make([]*dataset.File, 0, len(sub.Files))
+			for _, file := range sub.Files {
+				if !removed[file] {
+					files = append(files, file)
+				}
+			}
+			sub.AddSkipped(reason, len(sub.Files)-len(files))
+			sub.Files = files
+		}
+	}
+}
+
+// duplicateScope は重複したファイルの範囲を返す
+func duplicateScope(files []*dataset.File) string {
+	scope := ScopeSubclass
+	for _, file := range files[1:] {
+		if file.Class != files[0].Class {
+			return ScopeClasses
+		}
+		if file.Subclass != files[0].Subclass {
+			scope = ScopeSubclasses
+		}
+	}
+	return scope
+}
+
+// WriteDuplicateReport は重複ファイルの一覧を出力
+// 1行1ファイルで「SHA-256<TAB>範囲<TAB>クラス/サブクラス<TAB>ソース内のパス<TAB>kept|dropped」の形式とする
+func WriteDuplicateReport(sink Sink, groups []DuplicateGroup) error {
+	var report strings.Builder
+	for _, group := range groups {
+		for i, file := range group.Files {
+			status := "kept"
+			if group.Dropped[i] {
+				status = "dropped"
+			}
+			fmt.Fprintf(&report, "%s\t%s\t%s/%s\t%s\t%s\n", group.Hash, group.Scope, file.Class, file.Subclass, file.Path, status)
+		}
+	}
+
+	if err := sink.WriteFile(DuplicatesFileName, []byte(report.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", DuplicatesFileName, err)
+	}
+	log.Printf("重複ファイルの一覧を出力しました: %s (%d組)", DuplicatesFileName, len(groups))
+	return nil
+}
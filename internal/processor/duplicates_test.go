@@ -0,0 +1,196 @@
+package processor
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+)
+
+// testClasses は「クラス/サブクラス/ファイル」形式のパスからクラス名・サブクラス名・パス順のデータセットを作成する
+func testClasses(fsys fstest.MapFS) []*dataset.Class {
+	paths := make([]string, 0, len(fsys))
+	for p := range fsys {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var classes []*dataset.Class
+	for _, p := range paths {
+		parts := strings.SplitN(p, "/", 3)
+		if len(classes) == 0 || classes[len(classes)-1].Name != parts[0] {
+			classes = append(classes, &dataset.Class{Name: parts[0]})
+		}
+		class := classes[len(classes)-1]
+		if len(class.Subclasses) == 0 || class.Subclasses[len(class.Subclasses)-1].Name != parts[1] {
+			class.Subclasses = append(class.Subclasses, &dataset.Subclass{Name: parts[1]})
+		}
+		sub := class.Subclasses[len(class.Subclasses)-1]
+		sub.Files = append(sub.Files, dataset.NewFiles(fsys, []string{p}, parts[0], parts[1])...)
+	}
+	return classes
+}
+
+// remainingFiles はデータセットに残ったファイルのパスを返す
+func remainingFiles(classes []*dataset.Class) []string {
+	var paths []string
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			for _, file := range sub.Files {
+				paths = append(paths, file.Path)
+			}
+		}
+	}
+	return paths
+}
+
+// skippedCounts は「クラス/サブクラス」ごとの除外理由の件数を返す（件数が0のものを除く）
+func skippedCounts(classes []*dataset.Class, reason string) map[string]int {
+	counts := make(map[string]int)
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			if n := sub.Skipped[reason]; n > 0 {
+				counts[path.Join(class.Name, sub.Name)] = n
+			}
+		}
+	}
+	return counts
+}
+
+// TestRemoveDuplicates は内容が同じファイルの検出・範囲の判定と、方針ごとの除外を確認する
+func TestRemoveDuplicates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"A/A1/a.jpg": {Data: []byte("same-subclass")},
+		"A/A1/b.jpg": {Data: []byte("same-subclass")},
+		"A/A1/c.jpg": {Data: []byte("same-class")},
+		"A/A2/d.jpg": {Data: []byte("same-class")},
+		"A/A2/e.jpg": {Data: []byte("other-class")},
+		"B/B1/f.jpg": {Data: []byte("other-class")},
+		"B/B1/g.jpg": {Data: []byte("unique")},
+	}
+	wantGroups := []struct {
+		scope string
+		paths []string
+	}{
+		{scope: ScopeSubclass, paths: []string{"A/A1/a.jpg", "A/A1/b.jpg"}},
+		{scope: ScopeSubclasses, paths: []string{"A/A1/c.jpg", "A/A2/d.jpg"}},
+		{scope: ScopeClasses, paths: []string{"A/A2/e.jpg", "B/B1/f.jpg"}},
+	}
+
+	tests := []struct {
+		policy      string
+		wantErr     bool
+		wantFiles   []string
+		wantDropped []bool // 組内の順序で、各組に共通
+		wantSkipped map[string]int
+	}{
+		{
+			policy:      config.DedupKeepFirst,
+			wantFiles:   []string{"A/A1/a.jpg", "A/A1/c.jpg", "A/A2/e.jpg", "B/B1/g.jpg"},
+			wantDropped: []bool{false, true},
+			wantSkipped: map[string]int{"A/A1": 1, "A/A2": 1, "B/B1": 1},
+		},
+		{
+			policy:      config.DedupDropAll,
+			wantFiles:   []string{"B/B1/g.jpg"},
+			wantDropped: []bool{true, true},
+			wantSkipped: map[string]int{"A/A1": 3, "A/A2": 2, "B/B1": 1},
+		},
+		{
+			policy:      config.DedupError,
+			wantErr:     true,
+			wantFiles:   []string{"A/A1/a.jpg", "A/A1/b.jpg", "A/A1/c.jpg", "A/A2/d.jpg", "A/A2/e.jpg", "B/B1/f.jpg", "B/B1/g.jpg"},
+			wantDropped: []bool{false, false},
+			wantSkipped: map[string]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			classes := testClasses(fsys)
+			groups, err := RemoveDuplicates(classes, tt.policy, 4)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			if len(groups) != len(wantGroups) {
+				t.Fatalf("組の数 = %d, want %d", len(groups), len(wantGroups))
+			}
+			for i, group := range groups {
+				var paths []string
+				for _, file := range group.Files {
+					paths = append(paths, file.Path)
+				}
+				if group.Scope != wantGroups[i].scope || !slices.Equal(paths, wantGroups[i].paths) {
+					t.Errorf("組%d = %s %v, want %s %v", i, group.Scope, paths, wantGroups[i].scope, wantGroups[i].paths)
+				}
+				if !slices.Equal(group.Dropped, tt.wantDropped) {
+					t.Errorf("組%d の除外 = %v, want %v", i, group.Dropped, tt.wantDropped)
+				}
+				if group.Hash != group.Files[0].SHA256 || len(group.Hash) != 64 {
+					t.Errorf("組%d のハッシュ = %q", i, group.Hash)
+				}
+			}
+
+			if got := remainingFiles(classes); !slices.Equal(got, tt.wantFiles) {
+				t.Errorf("残ったファイル = %v, want %v", got, tt.wantFiles)
+			}
+			got := skippedCounts(classes, dataset.SkipDuplicate)
+			if len(got) != len(tt.wantSkipped) {
+				t.Errorf("重複の件数 = %v, want %v", got, tt.wantSkipped)
+			}
+			for key, n := range tt.wantSkipped {
+				if got[key] != n {
+					t.Errorf("%s の重複の件数 = %d, want %d", key, got[key], n)
+				}
+			}
+		})
+	}
+}
+
+// TestRemoveDuplicatesNone は重複がない場合に何も除外しないことを確認する
+func TestRemoveDuplicatesNone(t *testing.T) {
+	classes := testClasses(fstest.MapFS{
+		"A/A1/a.jpg": {Data: []byte("a")},
+		"A/A1/b.jpg": {Data: []byte("b")},
+		"B/B1/c.jpg": {Data: []byte("")},
+	})
+	groups, err := RemoveDuplicates(classes, config.DedupError, 2)
+	if err != nil || groups != nil {
+		t.Fatalf("RemoveDuplicates = %v, %v", groups, err)
+	}
+	if got := len(remainingFiles(classes)); got != 3 {
+		t.Errorf("残ったファイル数 = %d, want 3", got)
+	}
+}
+
+// TestWriteDuplicateReport は重複ファイルの一覧の形式を確認する
+func TestWriteDuplicateReport(t *testing.T) {
+	classes := testClasses(fstest.MapFS{
+		"A/A1/a.jpg": {Data: []byte("x")},
+		"B/B1/b.jpg": {Data: []byte("x")},
+	})
+	groups, err := RemoveDuplicates(classes, config.DedupKeepFirst, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := WriteDuplicateReport(NewDirSink(dir), groups); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, DuplicatesFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := groups[0].Hash
+	want := hash + "\tクラス間\tA/A1\tA/A1/a.jpg\tkept\n" + hash + "\tクラス間\tB/B1\tB/B1/b.jpg\tdropped\n"
+	if string(got) != want {
+		t.Errorf("一覧 = %q, want %q", got, want)
+	}
+}
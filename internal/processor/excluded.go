@@ -0,0 +1,44 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"dataset-splitter/internal/dataset"
+)
+
+// ExcludedFileName は走査時に除外したファイルの一覧を出力するファイル名
+const ExcludedFileName = "excluded.txt"
+
+// CountExcluded は走査時に除外したファイルの数を返す
+func CountExcluded(classes []*dataset.Class) int {
+	count := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			count += len(sub.Excluded)
+		}
+	}
+	return count
+}
+
+// WriteExcludedReport は走査時に除外したファイルの一覧を出力先のルートに書き込む
+// 各行は「クラス/サブクラス<TAB>パス<TAB>理由<TAB>補足」
+func WriteExcludedReport(sink Sink, classes []*dataset.Class) error {
+	var report strings.Builder
+	count := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			for _, excluded := range sub.Excluded {
+				fmt.Fprintf(&report, "%s/%s\t%s\t%s\t%s\n", class.Name, sub.Name, excluded.Path, excluded.Reason, excluded.Detail)
+				count++
+			}
+		}
+	}
+
+	if err := sink.WriteFile(ExcludedFileName, []byte(report.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", ExcludedFileName, err)
+	}
+	log.Printf("走査時に除外したファイルの一覧を出力しました: %s (%d件)", ExcludedFileName, count)
+	return nil
+}
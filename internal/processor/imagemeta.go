@@ -0,0 +1,276 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// JPEGのマーカー
+const (
+	jpegMarkerSOS   = 0xDA // Start of Scan（以降は画像データ）
+	jpegMarkerAPP1  = 0xE1 // Exif, XMP
+	jpegMarkerAPP2  = 0xE2 // ICCプロファイル
+	jpegMarkerAPP13 = 0xED // Photoshop（IPTC）
+	jpegMarkerAPP14 = 0xEE // Adobe（色変換の指定）
+)
+
+// exifOrientationTag はEXIFの向き（Orientation）のタグ番号
+const exifOrientationTag = 0x0112
+
+// jpegSegment はJPEGのSOSより前のマーカーセグメント
+type jpegSegment struct {
+	marker byte
+	data   []byte // マーカー・長さを含むセグメント全体
+}
+
+// payload はセグメントの内容（マーカーと長さを除く）を返す
+func (s jpegSegment) payload() []byte {
+	if len(s.data) < 4 {
+		return nil
+	}
+	return s.data[4:]
+}
+
+// isMetadata は撮影情報・位置情報を含みうるセグメント（Exif, XMP, IPTC）かどうかを返す
+func (s jpegSegment) isMetadata() bool {
+	return s.marker == jpegMarkerAPP1 || s.marker == jpegMarkerAPP13
+}
+
+// parseJPEG はJPEGをSOSより前のセグメントと、SOS以降の画像データに分ける
+func parseJPEG(data []byte) ([]jpegSegment, []byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, nil, fmt.Errorf("JPEGではありません")
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xFF {
+			return nil, nil, fmt.Errorf("JPEGのセグメントが不正です（位置 %d）", pos)
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xFF:
+			// 埋め草
+			pos++
+			continue
+		case marker == jpegMarkerSOS:
+			return segments, data[pos:], nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// 長さを持たないマーカー
+			segments = append(segments, jpegSegment{marker: marker, data: data[pos : pos+2]})
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, nil, fmt.Errorf("JPEGのセグメントが途中で切れています")
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, nil, fmt.Errorf("JPEGのセグメントが途中で切れています")
+		}
+		segments = append(segments, jpegSegment{marker: marker, data: data[pos:end]})
+		pos = end
+	}
+}
+
+// buildJPEG はセグメントと画像データからJPEGを組み立てる
+func buildJPEG(segments []jpegSegment, scan []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+	for _, segment := range segments {
+		buf.Write(segment.data)
+	}
+	buf.Write(scan)
+	return buf.Bytes()
+}
+
+// jpegOrientation はAPP1（Exif）セグメントから向き（1〜8、ない場合は0）を返す
+// あわせてそのセグメントの番号（ない場合は-1）と、セグメント内の向きの値の位置を返す
+func jpegOrientation(segments []jpegSegment) (int, int, int) {
+	for i, segment := range segments {
+		if segment.marker != jpegMarkerAPP1 {
+			continue
+		}
+		if orientation, offset := exifOrientation(segment.payload()); orientation != 0 {
+			return orientation, i, offset + 4
+		}
+	}
+	return 0, -1, 0
+}
+
+// exifOrientation はExifのペイロードから向き（1〜8）とペイロード内の値の位置を返す（ない場合は0）
+func exifOrientation(payload []byte) (int, int) {
+	const header = "Exif\x00\x00"
+	if !bytes.HasPrefix(payload, []byte(header)) {
+		return 0, 0
+	}
+	tiff := payload[len(header):]
+	if len(tiff) < 8 {
+		return 0, 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0, 0
+	}
+
+	// IFD0のエントリ（12バイト: タグ, 型, 個数, 値）から向きを探す
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0, 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, 0
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// 型はSHORT（3）、値はエントリ内に格納される
+		if order.Uint16(tiff[entry+2:]) != 3 {
+			return 0, 0
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 0, 0
+		}
+		return orientation, len(header) + entry + 8
+	}
+	return 0, 0
+}
+
+// resetOrientation はAPP1（Exif）セグメントの向きの値を1（そのまま）に書き換えたコピーを返す
+func resetOrientation(segment jpegSegment, offset int) jpegSegment {
+	data := append([]byte(nil), segment.data...)
+	tiff := data[4+len("Exif\x00\x00"):]
+	if string(tiff[:2]) == "II" {
+		binary.LittleEndian.PutUint16(data[offset:], 1)
+	} else {
+		binary.BigEndian.PutUint16(data[offset:], 1)
+	}
+	return jpegSegment{marker: segment.marker, data: data}
+}
+
+// orientationSegment は向きのみを含むAPP1（Exif）セグメントを作成
+// メタデータを削除しつつ、画素に反映していない向きを残すために使用する
+func orientationSegment(orientation int) jpegSegment {
+	data := []byte{
+		0xFF, jpegMarkerAPP1, 0, 34, // マーカー, 長さ
+		'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0, 42, 0, 0, 0, 8, // ビッグエンディアン, IFD0の位置
+		0, 1, // エントリ数
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, // 向き（SHORT, 1個）
+		0, 0, 0, 0, // 次のIFDなし
+	}
+	return jpegSegment{marker: jpegMarkerAPP1, data: data}
+}
+
+// pngSignature はPNGのシグネチャ
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngMetadataChunks は撮影情報・位置情報を含みうるPNGのチャンク
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+}
+
+// stripPNGMetadata はPNGからExif・テキスト（XMPを含む）のチャンクを取り除く
+// 取り除くチャンクがない場合はnilを返す
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil, fmt.Errorf("PNGではありません")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	stripped := false
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("PNGのチャンクが途中で切れています")
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("PNGのチャンクが途中で切れています")
+		}
+		if pngMetadataChunks[string(data[pos+4:pos+8])] {
+			stripped = true
+		} else {
+			buf.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	if !stripped {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// WebPのVP8Xチャンクのフラグ
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebPMetadata はWebPからEXIF・XMPのチャンクを取り除く
+// 取り除くチャンクがない場合はnilを返す
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, fmt.Errorf("WebPではありません")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:12])
+	stripped := false
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("WebPのチャンクが途中で切れています")
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, fmt.Errorf("WebPのチャンクが途中で切れています")
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+			stripped = true
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if size > 0 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			buf.Write(chunk)
+		default:
+			buf.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	if !stripped {
+		return nil, nil
+	}
+	out := buf.Bytes()
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,247 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// exifPayload は向きのエントリを2番目に含むExifのペイロードを作成する
+// typ は向きのエントリの型（3: SHORT）
+func exifPayload(order binary.ByteOrder, orientation, typ uint16) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("Exif\x00\x00")
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+	binary.Write(&buf, order, uint16(2))
+	// メーカー名（ASCII, 4バイト）
+	binary.Write(&buf, order, []uint16{0x010F, 2})
+	binary.Write(&buf, order, uint32(4))
+	buf.WriteString("abc\x00")
+	// 向き
+	binary.Write(&buf, order, []uint16{exifOrientationTag, typ})
+	binary.Write(&buf, order, uint32(1))
+	binary.Write(&buf, order, []uint16{orientation, 0})
+	binary.Write(&buf, order, uint32(0))
+	return buf.Bytes()
+}
+
+// app1Segment はペイロードからAPP1セグメントを作成する
+func app1Segment(payload []byte) jpegSegment {
+	data := []byte{0xFF, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(data[2:], uint16(len(payload)+2))
+	return jpegSegment{marker: jpegMarkerAPP1, data: append(data, payload...)}
+}
+
+// TestExifOrientation はExifのペイロードから向きを読み取れることを確認する
+func TestExifOrientation(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    int
+	}{
+		{name: "リトルエンディアン", payload: exifPayload(binary.LittleEndian, 6, 3), want: 6},
+		{name: "ビッグエンディアン", payload: exifPayload(binary.BigEndian, 8, 3), want: 8},
+		{name: "そのまま", payload: exifPayload(binary.LittleEndian, 1, 3), want: 1},
+		{name: "範囲外の値", payload: exifPayload(binary.LittleEndian, 9, 3), want: 0},
+		{name: "0", payload: exifPayload(binary.BigEndian, 0, 3), want: 0},
+		{name: "SHORT以外の型", payload: exifPayload(binary.LittleEndian, 6, 4), want: 0},
+		{name: "Exifでない", payload: []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"), want: 0},
+		{name: "途中で切れている", payload: exifPayload(binary.LittleEndian, 6, 3)[:30], want: 0},
+		{name: "空", payload: nil, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, offset := exifOrientation(tt.payload)
+			if got != tt.want {
+				t.Fatalf("向き = %d, want %d", got, tt.want)
+			}
+			if got == 0 {
+				return
+			}
+			// 値の位置を書き換えると向きが変わる
+			segment := resetOrientation(app1Segment(tt.payload), offset+4)
+			if reset, _ := exifOrientation(segment.payload()); reset != 1 {
+				t.Errorf("書き換えた向き = %d, want 1", reset)
+			}
+		})
+	}
+}
+
+// TestOrientationSegment は向きのみを含むExifから向きを読み取れることを確認する
+func TestOrientationSegment(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		segment := orientationSegment(orientation)
+		if got := int(binary.BigEndian.Uint16(segment.data[2:])); got != len(segment.data)-2 {
+			t.Errorf("向き %d: セグメントの長さ = %d, want %d", orientation, got, len(segment.data)-2)
+		}
+		if got, _, _ := jpegOrientation([]jpegSegment{segment}); got != orientation {
+			t.Errorf("向き = %d, want %d", got, orientation)
+		}
+	}
+}
+
+// TestApplyOrientation は向きごとに左上・右上の画素が正しい位置へ移ることを確認する
+func TestApplyOrientation(t *testing.T) {
+	const w, h = 3, 2
+	topLeft := color.RGBA{R: 255, A: 255}
+	topRight := color.RGBA{G: 255, A: 255}
+	src := image.NewRGBA(image.Rect(10, 20, 10+w, 20+h)) // 原点以外から始まる画像
+	src.Set(10, 20, topLeft)
+	src.Set(10+w-1, 20, topRight)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		topLeft     image.Point
+		topRight    image.Point
+		description string
+	}{
+		{1, image.Pt(w, h), image.Pt(0, 0), image.Pt(w-1, 0), "そのまま"},
+		{2, image.Pt(w, h), image.Pt(w-1, 0), image.Pt(0, 0), "左右反転"},
+		{3, image.Pt(w, h), image.Pt(w-1, h-1), image.Pt(0, h-1), "180度回転"},
+		{4, image.Pt(w, h), image.Pt(0, h-1), image.Pt(w-1, h-1), "上下反転"},
+		{5, image.Pt(h, w), image.Pt(0, 0), image.Pt(0, w-1), "転置"},
+		{6, image.Pt(h, w), image.Pt(h-1, 0), image.Pt(h-1, w-1), "時計回りに90度"},
+		{7, image.Pt(h, w), image.Pt(h-1, w-1), image.Pt(h-1, 0), "反転した転置"},
+		{8, image.Pt(h, w), image.Pt(0, w-1), image.Pt(0, 0), "反時計回りに90度"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			dst := applyOrientation(src, tt.orientation)
+			if got := dst.Bounds().Size(); got != tt.size {
+				t.Fatalf("大きさ = %v, want %v", got, tt.size)
+			}
+			if got := color.RGBAModel.Convert(dst.At(tt.topLeft.X, tt.topLeft.Y)); got != topLeft {
+				t.Errorf("左上の画素が %v にありません（%v）", tt.topLeft, got)
+			}
+			if got := color.RGBAModel.Convert(dst.At(tt.topRight.X, tt.topRight.Y)); got != topRight {
+				t.Errorf("右上の画素が %v にありません（%v）", tt.topRight, got)
+			}
+		})
+	}
+}
+
+// testJPEG は向きを含むExifとXMPを持つ4×2のJPEGを作成する（orientationが0の場合はExifなし）
+func testJPEG(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	segments, scan, err := parseJPEG(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := []jpegSegment{app1Segment([]byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))}
+	if orientation != 0 {
+		extra = append([]jpegSegment{app1Segment(exifPayload(binary.LittleEndian, orientation, 3))}, extra...)
+	}
+	return buildJPEG(append(extra, segments...), scan)
+}
+
+// TestTransformJPEGOrientation は向きの反映・メタデータの削除で、表示上の向きが保たれることを確認する
+func TestTransformJPEGOrientation(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            TransformOptions
+		orientation     uint16
+		wantUnchanged   bool
+		wantSize        image.Point
+		wantOrientation int // 出力のExifの向き（0: Exifなし）
+		wantMetadata    int // 出力のAPP1セグメントの数
+	}{
+		{
+			name:          "向きの反映（そのまま）",
+			opts:          TransformOptions{ApplyOrientation: true},
+			orientation:   1,
+			wantUnchanged: true,
+		},
+		{
+			name:            "向きの反映",
+			opts:            TransformOptions{ApplyOrientation: true},
+			orientation:     6,
+			wantSize:        image.Pt(2, 4),
+			wantOrientation: 1,
+			wantMetadata:    2,
+		},
+		{
+			name:         "向きの反映とメタデータの削除",
+			opts:         TransformOptions{ApplyOrientation: true, StripMetadata: true},
+			orientation:  6,
+			wantSize:     image.Pt(2, 4),
+			wantMetadata: 0,
+		},
+		{
+			name:            "メタデータの削除で向きを残す",
+			opts:            TransformOptions{StripMetadata: true},
+			orientation:     6,
+			wantSize:        image.Pt(4, 2),
+			wantOrientation: 6,
+			wantMetadata:    1,
+		},
+		{
+			name:         "メタデータの削除（そのまま）",
+			opts:         TransformOptions{StripMetadata: true},
+			orientation:  1,
+			wantSize:     image.Pt(4, 2),
+			wantMetadata: 0,
+		},
+		{
+			name:         "メタデータの削除（Exifなし）",
+			opts:         TransformOptions{StripMetadata: true},
+			wantSize:     image.Pt(4, 2),
+			wantMetadata: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Quality = 95
+			out, _, err := tt.opts.transformJPEG(testJPEG(t, tt.orientation))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantUnchanged {
+				if out != nil {
+					t.Error("変換しない場合はnilを返す必要があります")
+				}
+				return
+			}
+			if out == nil {
+				t.Fatal("変換されていません")
+			}
+
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("出力をデコードできません: %v", err)
+			}
+			if got := image.Pt(cfg.Width, cfg.Height); got != tt.wantSize {
+				t.Errorf("大きさ = %v, want %v", got, tt.wantSize)
+			}
+			segments, _, err := parseJPEG(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, _ := jpegOrientation(segments); got != tt.wantOrientation {
+				t.Errorf("向き = %d, want %d", got, tt.wantOrientation)
+			}
+			app1 := 0
+			for _, segment := range segments {
+				if segment.marker == jpegMarkerAPP1 {
+					app1++
+				}
+			}
+			if app1 != tt.wantMetadata {
+				t.Errorf("APP1セグメントの数 = %d, want %d", app1, tt.wantMetadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math/bits"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// LeakageFileName は教師データと検証データにまたがる類似画像の一覧を出力するファイル名
+const LeakageFileName = "leakage.txt"
+
+// dHashの縮小サイズ（横9×縦8の輝度から64ビットを作る）
+const (
+	dHashWidth  = 9
+	dHashHeight = 8
+)
+
+// LeakPair は教師データと検証データにまたがる類似画像の組
+type LeakPair struct {
+	Train      string // 教師データ側の出力先パス
+	Validation string // 検証データ側の出力先パス
+	Distance   int    // dHashのハミング距離
+	Moved      bool   // 検証データ側のファイルを教師データへ移したかどうか
+}
+
+// DifferenceHash は画像のdHash（隣り合う画素の輝度差による64ビットの知覚ハッシュ）を計算
+// リサイズ・再エンコードされた画像でも近い値になる
+func DifferenceHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	// 9×8の領域ごとに輝度を平均して縮小
+	var sums [dHashHeight][dHashWidth]float64
+	var counts [dHashHeight][dHashWidth]int
+	for y := 0; y < h; y++ {
+		cy := y * dHashHeight / h
+		for x := 0; x < w; x++ {
+			cx := x * dHashWidth / w
+			sums[cy][cx] += luminance(img, bounds.Min.X+x, bounds.Min.Y+y)
+			counts[cy][cx]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth-1; x++ {
+			left := sums[y][x] / float64(max(counts[y][x], 1))
+			right := sums[y][x+1] / float64(max(counts[y][x+1], 1))
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// luminance は画素の輝度を返す（JPEGのYCbCrはY成分を直接使用）
+func luminance(img image.Image, x, y int) float64 {
+	if ycc, ok := img.(*image.YCbCr); ok {
+		return float64(ycc.Y[ycc.YOffset(x, y)])
+	}
+	return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+}
+
+// hashImage は画像ファイルをデコードしてdHashを計算
+func hashImage(file *dataset.File) (uint64, error) {
+	f, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(bufio.NewReader(f))
+	if err != nil {
+		return 0, err
+	}
+	return DifferenceHash(img), nil
+}
+
+// leakEntry はdHashを計算したファイルと分割結果での位置
+type leakEntry struct {
+	plan  *SplitPlan
+	file  *dataset.File
+	train bool
+	hash  uint64
+}
+
+// relPath は出力先パスを返す
+func (e *leakEntry) relPath() string {
+	split := "validation"
+	if e.train {
+		split = "train"
+	}
+	return path.Join(split, e.plan.Name, e.file.OutputName())
+}
+
+// CheckLeakage は教師データと検証データにまたがる類似画像（dHashのハミング距離がmaxDistance以下）を検出
+// fixが真なら、類似画像の組に含まれる検証データのファイルを同じサブディレクトリの教師データへ移す
+func CheckLeakage(plans []*SplitPlan, maxDistance int, fix bool, maxWorkers int) []LeakPair {
+	var entries []*leakEntry
+	unverifiable := 0
+	for _, plan := range plans {
+		for _, split := range []struct {
+			files []*dataset.File
+			train bool
+		}{{plan.Train, true}, {plan.Validation, false}} {
+			for _, file := range split.files {
+				if !decodableKinds[utils.ExpectedKind(path.Ext(file.OutputName()))] {
+					unverifiable++
+					continue
+				}
+				entries = append(entries, &leakEntry{plan: plan, file: file, train: split.train})
+			}
+		}
+	}
+
+	log.Printf("類似画像の検査を開始: %d件 (ハミング距離 %d 以下)", len(entries), maxDistance)
+	if unverifiable > 0 {
+		log.Printf("  デコードできない形式のため未検査: %d件", unverifiable)
+	}
+
+	// 並列にdHashを計算（デコードできないファイルは検査から除く）
+	failed := make([]bool, len(entries))
+	sem := utils.NewSemaphore(max(maxWorkers, 1))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry *leakEntry) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			hash, err := hashImage(entry.file)
+			if err != nil {
+				log.Printf("警告: 類似画像の検査でデコードに失敗: %s: %v", entry.file.Path, err)
+				failed[i] = true
+				return
+			}
+			entry.hash = hash
+		}(i, entry)
+	}
+	wg.Wait()
+
+	hashed := entries[:0]
+	for i, entry := range entries {
+		if !failed[i] {
+			hashed = append(hashed, entry)
+		}
+	}
+
+	pairs := findLeakPairs(hashed, maxDistance)
+	if len(pairs) == 0 {
+		log.Printf("教師データと検証データにまたがる類似画像はありません")
+		return nil
+	}
+
+	var result []LeakPair
+	moved := make(map[*dataset.File]bool)
+	for _, pair := range pairs {
+		train, validation := pair[0], pair[1]
+		distance := bits.OnesCount64(train.hash ^ validation.hash)
+		result = append(result, LeakPair{Train: train.relPath(), Validation: validation.relPath(), Distance: distance, Moved: fix})
+		moved[validation.file] = true
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Train != result[j].Train {
+			return result[i].Train < result[j].Train
+		}
+		return result[i].Validation < result[j].Validation
+	})
+	for _, pair := range result {
+		log.Printf("  類似画像 (距離 %d): %s <-> %s", pair.Distance, pair.Train, pair.Validation)
+	}
+	log.Printf("教師データと検証データにまたがる類似画像: %d組", len(result))
+
+	if fix {
+		for _, plan := range plans {
+			validation := make([]*dataset.File, 0, len(plan.Validation))
+			for _, file := range plan.Validation {
+				if moved[file] {
+					plan.Train = append(plan.Train, file)
+				} else {
+					validation = append(validation, file)
+				}
+			}
+			plan.Validation = validation
+		}
+		log.Printf("類似画像の検証データ %d件を教師データへ移しました", len(moved))
+	}
+	return result
+}
+
+// findLeakPairs はハミング距離がmaxDistance以下の教師データと検証データの組を返す
+// 鳩の巣原理により、64ビットを maxDistance+1 個のブロックに分けると類似する組は少なくとも1ブロックが一致するため、
+// 一致するブロックを持つ組のみを比較する
+func findLeakPairs(entries []*leakEntry, maxDistance int) [][2]*leakEntry {
+	blocks := min(maxDistance+1, 64)
+	type bucketKey struct {
+		block int
+		value uint64
+	}
+	buckets := make(map[bucketKey][]int)
+	for i, entry := range entries {
+		for b := 0; b < blocks; b++ {
+			key := bucketKey{block: b, value: hashBlock(entry.hash, b, blocks)}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	seen := make(map[[2]int]bool)
+	var pairs [][2]*leakEntry
+	for _, members := range buckets {
+		for i := 0; i < len(members); i++ {
+			for j := i + 1; j < len(members); j++ {
+				ia, ib := members[i], members[j]
+				if entries[ia].train == entries[ib].train {
+					continue
+				}
+				if !entries[ia].train {
+					ia, ib = ib, ia
+				}
+				key := [2]int{ia, ib}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				if bits.OnesCount64(entries[ia].hash^entries[ib].hash) <= maxDistance {
+					pairs = append(pairs, [2]*leakEntry{entries[ia], entries[ib]})
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// hashBlock はハッシュをblocks個に分けたうちb番目のブロックの値を返す
+func hashBlock(hash uint64, b, blocks int) uint64 {
+	start := b * 64 / blocks
+	end := (b + 1) * 64 / blocks
+	return (hash >> uint(start)) & (1<<uint(end-start) - 1)
+}
+
+// WriteLeakageReport は類似画像の一覧を出力
+// 1行1組で「ハミング距離<TAB>教師データのパス<TAB>検証データのパス<TAB>kept|moved」の形式とする
+// パスは移動前の出力先パス
+func WriteLeakageReport(sink Sink, pairs []LeakPair) error {
+	var report strings.Builder
+	for _, pair := range pairs {
+		status := "kept"
+		if pair.Moved {
+			status = "moved"
+		}
+		fmt.Fprintf(&report, "%d\t%s\t%s\t%s\n", pair.Distance, pair.Train, pair.Validation, status)
+	}
+
+	if err := sink.WriteFile(LeakageFileName, []byte(report.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", LeakageFileName, err)
+	}
+	log.Printf("類似画像の一覧を出力しました: %s (%d組)", LeakageFileName, len(pairs))
+	return nil
+}
@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/bits"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"dataset-splitter/internal/dataset"
+)
+
+// testImage はパターンごとに輝度の変化が異なるグレースケール画像を作成する
+// brightness を加えても隣り合う領域の大小関係は変わらない
+func testImage(w, h, pattern int, brightness uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v int
+			switch pattern {
+			case 0: // 左から右へ明るくなる
+				v = x * 200 / w
+			case 1: // 右から左へ明るくなる
+				v = 200 - x*200/w
+			default: // 市松模様
+				v = ((x*8/w + y*8/h) % 2) * 200
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(v) + brightness})
+		}
+	}
+	return img
+}
+
+// encodePNG は画像をPNGにエンコードする
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestDifferenceHash は大きさ・明るさを変えた画像のdHashが近く、異なる画像のdHashが遠いことを確認する
+func TestDifferenceHash(t *testing.T) {
+	base := DifferenceHash(testImage(90, 80, 0, 0))
+	tests := []struct {
+		name        string
+		img         image.Image
+		maxDistance int
+		minDistance int
+	}{
+		{name: "同じ画像", img: testImage(90, 80, 0, 0), maxDistance: 0},
+		{name: "縮小", img: testImage(45, 40, 0, 0), maxDistance: 4},
+		{name: "拡大・縦横比の変更", img: testImage(300, 100, 0, 0), maxDistance: 4},
+		{name: "明るさの変更", img: testImage(90, 80, 0, 40), maxDistance: 4},
+		{name: "左右反転", img: testImage(90, 80, 1, 0), minDistance: 32, maxDistance: 64},
+		{name: "異なる模様", img: testImage(90, 80, 2, 0), minDistance: 16, maxDistance: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := bits.OnesCount64(base ^ DifferenceHash(tt.img))
+			if distance < tt.minDistance || distance > tt.maxDistance {
+				t.Errorf("ハミング距離 = %d, want %d..%d", distance, tt.minDistance, tt.maxDistance)
+			}
+		})
+	}
+
+	if got := DifferenceHash(image.NewGray(image.Rect(0, 0, 0, 0))); got != 0 {
+		t.Errorf("空の画像のdHash = %x, want 0", got)
+	}
+}
+
+// TestFindLeakPairs はブロックで絞り込んだ比較が総当たりの比較と同じ組を返すことを確認する
+func TestFindLeakPairs(t *testing.T) {
+	hashes := []struct {
+		hash  uint64
+		train bool
+	}{
+		{0x0000000000000000, true},
+		{0x0000000000000001, false}, // 0番目と距離1
+		{0x000000000000000F, false}, // 0番目と距離4
+		{0x00000000000000FF, true},  // 2番目と距離4
+		{0xFFFFFFFF00000000, false}, // 0番目と距離32
+		{0xFFFFFFFFFFFFFFFF, true},  // 4番目と距離32
+		{0x8000000000000001, true},  // 1番目と距離1
+		{0x0000000000000003, true},  // 1番目・2番目と距離1・2
+	}
+	var entries []*leakEntry
+	for _, h := range hashes {
+		entries = append(entries, &leakEntry{hash: h.hash, train: h.train})
+	}
+
+	for _, maxDistance := range []int{0, 1, 2, 4, 8, 32, 63, 64} {
+		var want [][2]int
+		for i, a := range entries {
+			for j, b := range entries {
+				if a.train && !b.train && bits.OnesCount64(a.hash^b.hash) <= maxDistance {
+					want = append(want, [2]int{i, j})
+				}
+			}
+		}
+
+		var got [][2]int
+		for _, pair := range findLeakPairs(entries, maxDistance) {
+			if !pair[0].train || pair[1].train {
+				t.Errorf("距離 %d: 教師データ・検証データの順になっていません", maxDistance)
+			}
+			got = append(got, [2]int{slices.Index(entries, pair[0]), slices.Index(entries, pair[1])})
+		}
+		slices.SortFunc(got, func(a, b [2]int) int {
+			if a[0] != b[0] {
+				return a[0] - b[0]
+			}
+			return a[1] - b[1]
+		})
+		if !slices.Equal(got, want) {
+			t.Errorf("距離 %d: 組 = %v, want %v", maxDistance, got, want)
+		}
+	}
+}
+
+// TestCheckLeakage は教師データと検証データにまたがる類似画像の検出と、検証データ側の教師データへの移動を確認する
+func TestCheckLeakage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"A/A1/t0.png":     {Data: encodePNG(t, testImage(90, 80, 0, 0))},
+		"A/A1/t1.png":     {Data: encodePNG(t, testImage(90, 80, 2, 0))},
+		"A/A1/v0.png":     {Data: encodePNG(t, testImage(45, 40, 0, 30))}, // t0 の縮小・明るさ変更
+		"A/A1/v1.png":     {Data: encodePNG(t, testImage(90, 80, 1, 0))},
+		"A/A1/broken.png": {Data: []byte("not a png")},
+		"A/A1/note.txt":   {Data: []byte("text")},
+	}
+	newPlan := func() *SplitPlan {
+		return &SplitPlan{
+			Class:      "A",
+			Name:       "A1",
+			Train:      dataset.NewFiles(fsys, []string{"A/A1/t0.png", "A/A1/t1.png", "A/A1/note.txt"}, "A", "A1"),
+			Validation: dataset.NewFiles(fsys, []string{"A/A1/v0.png", "A/A1/v1.png", "A/A1/broken.png"}, "A", "A1"),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		maxDistance    int
+		fix            bool
+		wantPairs      []string // 教師データ -> 検証データ
+		wantValidation []string
+	}{
+		{name: "距離0", maxDistance: 0, wantPairs: []string{"train/A1/t0.png -> validation/A1/v0.png"}, wantValidation: []string{"v0.png", "v1.png", "broken.png"}},
+		{name: "検出のみ", maxDistance: 4, wantPairs: []string{"train/A1/t0.png -> validation/A1/v0.png"}, wantValidation: []string{"v0.png", "v1.png", "broken.png"}},
+		{name: "教師データへ移す", maxDistance: 4, fix: true, wantPairs: []string{"train/A1/t0.png -> validation/A1/v0.png"}, wantValidation: []string{"v1.png", "broken.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := newPlan()
+			pairs := CheckLeakage([]*SplitPlan{plan}, tt.maxDistance, tt.fix, 2)
+
+			var got []string
+			for _, pair := range pairs {
+				got = append(got, pair.Train+" -> "+pair.Validation)
+				if pair.Moved != tt.fix {
+					t.Errorf("%s: Moved = %t, want %t", pair.Validation, pair.Moved, tt.fix)
+				}
+				if pair.Distance > tt.maxDistance {
+					t.Errorf("%s: 距離 %d が上限 %d を超えています", pair.Validation, pair.Distance, tt.maxDistance)
+				}
+			}
+			if !slices.Equal(got, tt.wantPairs) {
+				t.Errorf("類似画像 = %v, want %v", got, tt.wantPairs)
+			}
+
+			var validation []string
+			for _, file := range plan.Validation {
+				validation = append(validation, file.OutputName())
+			}
+			if !slices.Equal(validation, tt.wantValidation) {
+				t.Errorf("検証データ = %v, want %v", validation, tt.wantValidation)
+			}
+			if total := len(plan.Train) + len(plan.Validation); total != 6 {
+				t.Errorf("ファイル数 = %d, want 6", total)
+			}
+		})
+	}
+}
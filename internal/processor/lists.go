@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ClassesFileName はクラス名とラベル番号の対応を出力するファイル名
+const ClassesFileName = "classes.txt"
+
+// listFileNames は分割名とリストファイル名の対応
+var listFileNames = map[string]string{
+	"train":      "train.txt",
+	"validation": "val.txt",
+}
+
+// WriteListFiles は「相対パス ラベル番号」形式のリストファイルを出力
+// ラベル番号はクラス名（出力先のサブディレクトリ名）を整列した順に0から割り当てる
+func WriteListFiles(sink Sink, records []RecordedFile) error {
+	// クラス名の収集
+	classSet := make(map[string]bool)
+	for _, record := range records {
+		parts := strings.SplitN(record.RelPath, "/", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		classSet[parts[1]] = true
+	}
+
+	classes := make([]string, 0, len(classSet))
+	for className := range classSet {
+		classes = append(classes, className)
+	}
+	sort.Strings(classes)
+
+	labels := make(map[string]int, len(classes))
+	for i, className := range classes {
+		labels[className] = i
+	}
+
+	// 分割ごとのリストを作成
+	lists := make(map[string]*strings.Builder)
+	for _, record := range records {
+		parts := strings.SplitN(record.RelPath, "/", 3)
+		if len(parts) < 3 {
+			continue
+		}
+		fileName, ok := listFileNames[parts[0]]
+		if !ok {
+			continue
+		}
+		if lists[fileName] == nil {
+			lists[fileName] = &strings.Builder{}
+		}
+		fmt.Fprintf(lists[fileName], "%s %d\n", record.RelPath, labels[parts[1]])
+	}
+
+	// クラス対応表の書き込み
+	var classList strings.Builder
+	for _, className := range classes {
+		classList.WriteString(className + "\n")
+	}
+	if err := sink.WriteFile(ClassesFileName, []byte(classList.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", ClassesFileName, err)
+	}
+
+	// リストファイルの書き込み
+	for _, fileName := range []string{"train.txt", "val.txt"} {
+		list, ok := lists[fileName]
+		if !ok {
+			continue
+		}
+		if err := sink.WriteFile(fileName, []byte(list.String())); err != nil {
+			return fmt.Errorf("%sの書き込みに失敗: %v", fileName, err)
+		}
+	}
+
+	log.Printf("リストファイルを出力しました: %d クラス, %d ファイル", len(classes), len(records))
+	return nil
+}
@@ -0,0 +1,73 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+)
+
+// MetadataFileName はHugging Face imagefolder形式のメタデータファイル名
+const MetadataFileName = "metadata.jsonl"
+
+// metadataRecord はmetadata.jsonlの1行
+type metadataRecord struct {
+	FileName    string `json:"file_name"`
+	Subclass    string `json:"subclass"`
+	Class       string `json:"class"`
+	Group       string `json:"group,omitempty"`
+	BinaryLabel string `json:"binary_label,omitempty"`
+}
+
+// WriteMetadataFiles は分割ごとにHugging Face imagefolder形式のmetadata.jsonlを出力
+// file_nameは分割ディレクトリからの相対パスとなる
+// グループが設定されている場合はgroup列を、positiveClassが指定されている場合（二値分類モード）はbinary_label列（positive/negative）を追加する
+func WriteMetadataFiles(sink Sink, records []RecordedFile, positiveClass string) error {
+	buffers := make(map[string]*bytes.Buffer)
+	var splits []string
+
+	for _, record := range records {
+		parts := strings.SplitN(record.RelPath, "/", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		split := parts[0]
+
+		row := metadataRecord{
+			FileName: parts[1],
+			Subclass: record.File.Subclass,
+			Class:    record.File.Class,
+			Group:    record.File.Group,
+		}
+		if positiveClass != "" {
+			row.BinaryLabel = "negative"
+			if record.File.Class == positiveClass {
+				row.BinaryLabel = "positive"
+			}
+		}
+
+		line, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("メタデータの変換に失敗: %v", err)
+		}
+
+		if buffers[split] == nil {
+			buffers[split] = &bytes.Buffer{}
+			splits = append(splits, split)
+		}
+		buffers[split].Write(line)
+		buffers[split].WriteByte('\n')
+	}
+
+	for _, split := range splits {
+		metadataPath := path.Join(split, MetadataFileName)
+		if err := sink.WriteFile(metadataPath, buffers[split].Bytes()); err != nil {
+			return fmt.Errorf("%sの書き込みに失敗: %v", metadataPath, err)
+		}
+	}
+
+	log.Printf("metadata.jsonlを出力しました: %d 分割, %d ファイル", len(splits), len(records))
+	return nil
+}
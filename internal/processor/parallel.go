@@ -3,15 +3,15 @@ package processor
 import (
 	"fmt"
 	"log"
-	"path/filepath"
 	"sync"
 
+	"dataset-splitter/internal/dataset"
 	"dataset-splitter/internal/utils"
 )
 
 // ProcessClassesParallel はメインクラスの並列処理
-func ProcessClassesParallel(config interface{}, classDirs []string, processFunc func(string) error) error {
-	if len(classDirs) == 0 {
+func ProcessClassesParallel(config interface{}, classes []*dataset.Class, processFunc func(*dataset.Class) error) error {
+	if len(classes) == 0 {
 		return nil
 	}
 
@@ -26,9 +26,9 @@ func ProcessClassesParallel(config interface{}, classDirs []string, processFunc
 
 	// 並列度が1の場合は順次処理
 	if maxConcurrent <= 1 {
-		for _, classDir := range classDirs {
-			if err := processFunc(classDir); err != nil {
-				log.Printf("警告: クラス %s の処理に失敗: %v", filepath.Base(classDir), err)
+		for _, class := range classes {
+			if err := processFunc(class); err != nil {
+				log.Printf("警告: クラス %s の処理に失敗: %v", class.Name, err)
 			}
 		}
 		return nil
@@ -37,21 +37,21 @@ func ProcessClassesParallel(config interface{}, classDirs []string, processFunc
 	// 並列処理
 	sem := utils.NewSemaphore(maxConcurrent)
 	var wg sync.WaitGroup
-	errors := make(chan error, len(classDirs))
+	errors := make(chan error, len(classes))
 
-	log.Printf("並列処理を開始: %dクラスを%d並列で処理", len(classDirs), maxConcurrent)
+	log.Printf("並列処理を開始: %dクラスを%d並列で処理", len(classes), maxConcurrent)
 
-	for _, classDir := range classDirs {
+	for _, class := range classes {
 		wg.Add(1)
-		go func(dir string) {
+		go func(c *dataset.Class) {
 			defer wg.Done()
 			sem.Acquire()
 			defer sem.Release()
 
-			if err := processFunc(dir); err != nil {
-				errors <- fmt.Errorf("クラス %s の処理に失敗: %v", filepath.Base(dir), err)
+			if err := processFunc(c); err != nil {
+				errors <- fmt.Errorf("クラス %s の処理に失敗: %v", c.Name, err)
 			}
-		}(classDir)
+		}(class)
 	}
 
 	wg.Wait()
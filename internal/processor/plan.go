@@ -0,0 +1,71 @@
+package processor
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// SplitPlan は出力先のサブディレクトリ（サブクラス、二値分類では positive / negative）ごとの分割結果
+// 分割をすべて決めてからコピーすることで、コピー前に分割をまたいだ検査・調整ができる
+type SplitPlan struct {
+	Class      string // 元のクラス名（二値分類では空）
+	Name       string // 出力先のサブディレクトリ名
+	Train      []*dataset.File
+	Validation []*dataset.File
+}
+
+// SortPlans は分割結果をクラス名・サブディレクトリ名順に整列
+func SortPlans(plans []*SplitPlan) {
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].Class != plans[j].Class {
+			return plans[i].Class < plans[j].Class
+		}
+		return plans[i].Name < plans[j].Name
+	})
+}
+
+// CopyPlans は分割結果に従ってファイルをコピー
+// 最大maxConcurrentのサブディレクトリを並列に処理し、それぞれmaxWorkersの並列度でコピーする
+func CopyPlans(sink Sink, plans []*SplitPlan, maxConcurrent, maxWorkers int) error {
+	sem := utils.NewSemaphore(max(maxConcurrent, 1))
+	var wg sync.WaitGroup
+	errors := make(chan error, len(plans)*2)
+
+	for _, plan := range plans {
+		wg.Add(1)
+		go func(plan *SplitPlan) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			if err := CopyFilesParallel(sink, "train", plan.Name, plan.Train, maxWorkers); err != nil {
+				errors <- fmt.Errorf("'%s' の教師データのコピーに失敗: %v", plan.Name, err)
+			}
+			if err := CopyFilesParallel(sink, "validation", plan.Name, plan.Validation, maxWorkers); err != nil {
+				errors <- fmt.Errorf("'%s' の検証データのコピーに失敗: %v", plan.Name, err)
+			}
+			log.Printf("  '%s' のコピー完了: 教師データ %d件, 検証データ %d件", plan.Name, len(plan.Train), len(plan.Validation))
+		}(plan)
+	}
+
+	wg.Wait()
+	close(errors)
+
+	// エラーの確認
+	var hasErrors bool
+	for err := range errors {
+		log.Printf("警告: %v", err)
+		hasErrors = true
+	}
+
+	if hasErrors {
+		return fmt.Errorf("一部のファイルのコピーに失敗しました")
+	}
+
+	return nil
+}
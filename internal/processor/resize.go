@@ -0,0 +1,241 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"dataset-splitter/internal/config"
+)
+
+// ResizeOptions はコピー時のリサイズの設定
+type ResizeOptions struct {
+	MaxSide int    // 長辺の上限（0: 指定なし。縮小のみ）
+	Width   int    // 出力の幅（0: 指定なし）
+	Height  int    // 出力の高さ（0: 指定なし）
+	Mode    string // 幅・高さを指定した場合の合わせ方 (fit, fill, crop)
+}
+
+// Enabled はリサイズが指定されているかを返す
+func (o ResizeOptions) Enabled() bool {
+	return o.MaxSide > 0 || o.Width > 0
+}
+
+// resizeImage は設定に従って画像をリサイズする（大きさが変わらない場合は元の画像を返す）
+func resizeImage(img image.Image, opts ResizeOptions) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+
+	if opts.MaxSide > 0 {
+		longest := max(w, h)
+		if longest <= opts.MaxSide {
+			return img
+		}
+		scale := float64(opts.MaxSide) / float64(longest)
+		return resample(img, bounds, scaled(w, scale), scaled(h, scale))
+	}
+
+	dw, dh := opts.Width, opts.Height
+	switch opts.Mode {
+	case config.ResizeFill:
+		// 縦横比を無視して引き伸ばす
+		if w == dw && h == dh {
+			return img
+		}
+		return resample(img, bounds, dw, dh)
+	case config.ResizeCrop:
+		// 縦横比を保って出力を覆うように拡大・縮小し、中央を切り出す
+		scale := math.Max(float64(dw)/float64(w), float64(dh)/float64(h))
+		cw := min(w, max(1, int(math.Round(float64(dw)/scale))))
+		ch := min(h, max(1, int(math.Round(float64(dh)/scale))))
+		x0 := bounds.Min.X + (w-cw)/2
+		y0 := bounds.Min.Y + (h-ch)/2
+		return resample(img, image.Rect(x0, y0, x0+cw, y0+ch), dw, dh)
+	default:
+		// 縦横比を保って出力に収まるように拡大・縮小し、余白を黒で埋める
+		scale := math.Min(float64(dw)/float64(w), float64(dh)/float64(h))
+		rw, rh := min(dw, scaled(w, scale)), min(dh, scaled(h, scale))
+		resized := resample(img, bounds, rw, rh)
+		canvas := image.NewRGBA(image.Rect(0, 0, dw, dh))
+		for i := 3; i < len(canvas.Pix); i += 4 {
+			canvas.Pix[i] = 0xff
+		}
+		offset := image.Pt((dw-rw)/2, (dh-rh)/2)
+		for y := 0; y < rh; y++ {
+			copy(canvas.Pix[canvas.PixOffset(offset.X, offset.Y+y):], resized.Pix[resized.PixOffset(0, y):resized.PixOffset(rw, y)])
+		}
+		return canvas
+	}
+}
+
+// scaled は長さを拡大・縮小した値を返す（1以上）
+func scaled(n int, scale float64) int {
+	return max(1, int(math.Round(float64(n)*scale)))
+}
+
+// resampleWeight は出力の1画素に対する入力画素の重み
+type resampleWeight struct {
+	index  int
+	weight float32
+}
+
+// resampleWeights は長さsrcからdstへの1次元の重みを計算
+// 縮小は面積平均、拡大は線形補間とする
+func resampleWeights(src, dst int) [][]resampleWeight {
+	weights := make([][]resampleWeight, dst)
+	scale := float64(src) / float64(dst)
+	for i := range weights {
+		if scale >= 1 {
+			start, end := float64(i)*scale, float64(i+1)*scale
+			for j := int(start); j < src && float64(j) < end; j++ {
+				overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+				if overlap > 0 {
+					weights[i] = append(weights[i], resampleWeight{j, float32(overlap / scale)})
+				}
+			}
+			continue
+		}
+		center := (float64(i)+0.5)*scale - 0.5
+		j := int(math.Floor(center))
+		t := float32(center - float64(j))
+		weights[i] = []resampleWeight{
+			{min(max(j, 0), src-1), 1 - t},
+			{min(max(j+1, 0), src-1), t},
+		}
+	}
+	return weights
+}
+
+// resample は画像のrectの範囲をdw×dhへ拡大・縮小する（横方向・縦方向の順に処理）
+func resample(img image.Image, rect image.Rectangle, dw, dh int) *image.RGBA {
+	sw, sh := rect.Dx(), rect.Dy()
+	xWeights := resampleWeights(sw, dw)
+	yWeights := resampleWeights(sh, dh)
+
+	// 横方向: 入力の各行をdw画素にする
+	row := make([]float32, sw*4)
+	horizontal := make([]float32, dw*sh*4)
+	for y := 0; y < sh; y++ {
+		readRow(img, rect.Min.X, rect.Min.Y+y, row)
+		out := horizontal[y*dw*4 : (y+1)*dw*4]
+		for x, ws := range xWeights {
+			var r, g, b, a float32
+			for _, w := range ws {
+				p := row[w.index*4 : w.index*4+4]
+				r += p[0] * w.weight
+				g += p[1] * w.weight
+				b += p[2] * w.weight
+				a += p[3] * w.weight
+			}
+			out[x*4], out[x*4+1], out[x*4+2], out[x*4+3] = r, g, b, a
+		}
+	}
+
+	// 縦方向
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y, ws := range yWeights {
+		pix := dst.Pix[y*dst.Stride : y*dst.Stride+dw*4]
+		for i := range pix {
+			var v float32
+			for _, w := range ws {
+				v += horizontal[w.index*dw*4+i] * w.weight
+			}
+			pix[i] = clamp8(v)
+		}
+	}
+	return dst
+}
+
+// readRow は画像の1行（x0から幅len(row)/4画素）をアルファ乗算済みのRGBA（0〜255）で読み込む
+func readRow(img image.Image, x0, y int, row []float32) {
+	n := len(row) / 4
+	switch src := img.(type) {
+	case *image.YCbCr:
+		for x := 0; x < n; x++ {
+			yi := src.YOffset(x0+x, y)
+			ci := src.COffset(x0+x, y)
+			r, g, b := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = float32(r), float32(g), float32(b), 255
+		}
+	case *image.RGBA:
+		pix := src.Pix[src.PixOffset(x0, y):]
+		for i := 0; i < n*4; i++ {
+			row[i] = float32(pix[i])
+		}
+	case *image.Gray:
+		pix := src.Pix[src.PixOffset(x0, y):]
+		for x := 0; x < n; x++ {
+			v := float32(pix[x])
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = v, v, v, 255
+		}
+	default:
+		for x := 0; x < n; x++ {
+			r, g, b, a := img.At(x0+x, y).RGBA()
+			row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = float32(r>>8), float32(g>>8), float32(b>>8), float32(a>>8)
+		}
+	}
+}
+
+// clamp8 は値を0〜255に丸める
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(v + 0.5)
+	}
+}
+
+// convertColorMode は画像を指定した色モード（config.ColorRGB, config.ColorGray）の8ビット画像に変換する
+// 透過部分は白で合成する
+func convertColorMode(img image.Image, mode string) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	row := make([]float32, w*4)
+
+	if mode == config.ColorGray {
+		dst := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			readRow(img, bounds.Min.X, bounds.Min.Y+y, row)
+			for x := 0; x < w; x++ {
+				r, g, b := flatten(row[x*4 : x*4+4])
+				dst.Pix[y*dst.Stride+x] = clamp8(0.299*r + 0.587*g + 0.114*b)
+			}
+		}
+		return dst
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		readRow(img, bounds.Min.X, bounds.Min.Y+y, row)
+		pix := dst.Pix[y*dst.Stride:]
+		for x := 0; x < w; x++ {
+			r, g, b := flatten(row[x*4 : x*4+4])
+			pix[x*4], pix[x*4+1], pix[x*4+2], pix[x*4+3] = clamp8(r), clamp8(g), clamp8(b), 255
+		}
+	}
+	return dst
+}
+
+// flatten はアルファ乗算済みの画素を白い背景に合成したRGBを返す
+func flatten(p []float32) (float32, float32, float32) {
+	background := 255 - p[3]
+	return p[0] + background, p[1] + background, p[2] + background
+}
+
+// hasAlpha は画像が透過を含みうる色モデルかどうかを返す
+func hasAlpha(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.YCbCrModel, color.GrayModel, color.Gray16Model, color.CMYKModel:
+		return false
+	}
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"slices"
+	"testing"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/utils"
+)
+
+// stripedImage は横方向に3等分して左から赤・緑・青で塗った画像を作成する
+func stripedImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	colors := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, colors[x*3/w])
+		}
+	}
+	return img
+}
+
+// TestResizeImage はリサイズの指定ごとの出力の大きさと、余白・切り出しの位置を確認する
+func TestResizeImage(t *testing.T) {
+	black := color.RGBA{A: 255}
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	tests := []struct {
+		name      string
+		src       image.Image
+		opts      ResizeOptions
+		wantSize  image.Point
+		unchanged bool
+		pixels    map[image.Point]color.RGBA // 出力の位置 -> 画素
+	}{
+		{
+			name:     "長辺の上限で縮小",
+			src:      stripedImage(300, 150),
+			opts:     ResizeOptions{MaxSide: 100},
+			wantSize: image.Pt(100, 50),
+			pixels:   map[image.Point]color.RGBA{{10, 25}: red, {50, 25}: green, {90, 25}: blue},
+		},
+		{
+			name:     "長辺の上限で縮小（縦長）",
+			src:      stripedImage(30, 300),
+			opts:     ResizeOptions{MaxSide: 100},
+			wantSize: image.Pt(10, 100),
+		},
+		{
+			name:      "長辺の上限より小さい画像はそのまま",
+			src:       stripedImage(90, 60),
+			opts:      ResizeOptions{MaxSide: 100},
+			unchanged: true,
+		},
+		{
+			name:     "極端な縦横比でも1画素以上",
+			src:      stripedImage(3000, 3),
+			opts:     ResizeOptions{MaxSide: 100},
+			wantSize: image.Pt(100, 1),
+		},
+		{
+			name:     "fit は余白を黒で埋める",
+			src:      stripedImage(300, 150),
+			opts:     ResizeOptions{Width: 100, Height: 100, Mode: config.ResizeFit},
+			wantSize: image.Pt(100, 100),
+			pixels:   map[image.Point]color.RGBA{{50, 5}: black, {50, 95}: black, {10, 50}: red, {50, 50}: green, {90, 50}: blue},
+		},
+		{
+			name:     "fit で拡大",
+			src:      stripedImage(30, 60),
+			opts:     ResizeOptions{Width: 100, Height: 100, Mode: config.ResizeFit},
+			wantSize: image.Pt(100, 100),
+			pixels:   map[image.Point]color.RGBA{{5, 50}: black, {95, 50}: black, {30, 50}: red, {50, 50}: green, {70, 50}: blue},
+		},
+		{
+			name:     "fill は縦横比を無視して引き伸ばす",
+			src:      stripedImage(300, 150),
+			opts:     ResizeOptions{Width: 60, Height: 120, Mode: config.ResizeFill},
+			wantSize: image.Pt(60, 120),
+			pixels:   map[image.Point]color.RGBA{{5, 5}: red, {30, 115}: green, {55, 60}: blue},
+		},
+		{
+			name:      "fill で同じ大きさはそのまま",
+			src:       stripedImage(60, 120),
+			opts:      ResizeOptions{Width: 60, Height: 120, Mode: config.ResizeFill},
+			unchanged: true,
+		},
+		{
+			name:     "crop は中央を切り出す",
+			src:      stripedImage(300, 100),
+			opts:     ResizeOptions{Width: 50, Height: 50, Mode: config.ResizeCrop},
+			wantSize: image.Pt(50, 50),
+			pixels:   map[image.Point]color.RGBA{{0, 0}: green, {49, 49}: green, {25, 25}: green},
+		},
+		{
+			name:     "crop で縦長に切り出す",
+			src:      stripedImage(300, 100),
+			opts:     ResizeOptions{Width: 30, Height: 100, Mode: config.ResizeCrop},
+			wantSize: image.Pt(30, 100),
+			pixels:   map[image.Point]color.RGBA{{0, 50}: green, {29, 50}: green},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resizeImage(tt.src, tt.opts)
+			if tt.unchanged {
+				if got != tt.src {
+					t.Error("大きさが変わらない場合は元の画像を返す必要があります")
+				}
+				return
+			}
+			if size := got.Bounds().Size(); size != tt.wantSize {
+				t.Fatalf("大きさ = %v, want %v", size, tt.wantSize)
+			}
+			for p, want := range tt.pixels {
+				if c := color.RGBAModel.Convert(got.At(p.X, p.Y)); c != want {
+					t.Errorf("%v の画素 = %v, want %v", p, c, want)
+				}
+			}
+		})
+	}
+}
+
+// TestResampleWeights は出力の各画素の重みの合計が1になり、入力の範囲に収まることを確認する
+func TestResampleWeights(t *testing.T) {
+	tests := []struct{ src, dst int }{
+		{100, 100}, {100, 33}, {7, 3}, {3000, 1}, {3, 7}, {1, 50}, {2, 3},
+	}
+	for _, tt := range tests {
+		for i, ws := range resampleWeights(tt.src, tt.dst) {
+			var sum float64
+			for _, w := range ws {
+				if w.index < 0 || w.index >= tt.src {
+					t.Errorf("%d→%d: 出力%d の入力の位置 %d が範囲外です", tt.src, tt.dst, i, w.index)
+				}
+				sum += float64(w.weight)
+			}
+			if math.Abs(sum-1) > 1e-4 {
+				t.Errorf("%d→%d: 出力%d の重みの合計 = %f, want 1", tt.src, tt.dst, i, sum)
+			}
+		}
+	}
+}
+
+// TestReencodeResize はリサイズ・再エンコードの指定に従って画像を変換することを確認する
+func TestReencodeResize(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, stripedImage(200, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       TransformOptions
+		wantFormat string
+		wantSize   image.Point
+		wantNil    bool
+		applied    []string
+	}{
+		{
+			name:       "縮小",
+			opts:       TransformOptions{Resize: ResizeOptions{MaxSide: 50}},
+			wantFormat: "png",
+			wantSize:   image.Pt(50, 25),
+			applied:    []string{transformResized, transformReencoded},
+		},
+		{
+			name:       "縮小してJPEGへ",
+			opts:       TransformOptions{Resize: ResizeOptions{MaxSide: 50}, Encode: config.EncodeJPEG, Quality: 90},
+			wantFormat: "jpeg",
+			wantSize:   image.Pt(50, 25),
+			applied:    []string{transformResized, transformReencoded},
+		},
+		{
+			name:       "大きさを指定",
+			opts:       TransformOptions{Resize: ResizeOptions{Width: 64, Height: 64, Mode: config.ResizeCrop}},
+			wantFormat: "png",
+			wantSize:   image.Pt(64, 64),
+			applied:    []string{transformResized, transformReencoded},
+		},
+		{
+			name:    "上限より小さい画像は変換しない",
+			opts:    TransformOptions{Resize: ResizeOptions{MaxSide: 500}},
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, applied, err := tt.opts.reencode(src.Bytes(), utils.KindPNG)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if out != nil {
+					t.Error("変換しない場合はnilを返す必要があります")
+				}
+				return
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+			if err != nil {
+				t.Fatalf("出力をデコードできません: %v", err)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("形式 = %s, want %s", format, tt.wantFormat)
+			}
+			if got := image.Pt(cfg.Width, cfg.Height); got != tt.wantSize {
+				t.Errorf("大きさ = %v, want %v", got, tt.wantSize)
+			}
+			if !slices.Equal(applied, tt.applied) {
+				t.Errorf("変換 = %v, want %v", applied, tt.applied)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/storage"
+)
+
+// Sink はファイルの出力先を抽象化
+type Sink interface {
+	// MkdirAll は出力先に相対パスのディレクトリを作成
+	MkdirAll(relDir string) error
+	// CopyFile はソースファイルを出力先の相対パスに書き込む
+	CopyFile(file *dataset.File, relPath string) error
+	// WriteFile はデータを出力先の相対パスに書き込む
+	WriteFile(relPath string, data []byte) error
+	// Close は出力を確定させる
+	Close() error
+}
+
+// DirSink はディレクトリへ出力するSink
+type DirSink struct {
+	root string
+}
+
+// NewDirSink はディレクトリへ出力するSinkを作成
+func NewDirSink(root string) *DirSink {
+	return &DirSink{root: root}
+}
+
+// MkdirAll は出力ディレクトリを作成
+func (s *DirSink) MkdirAll(relDir string) error {
+	return os.MkdirAll(filepath.Join(s.root, filepath.FromSlash(relDir)), 0755)
+}
+
+// CopyFile はファイルを出力ディレクトリへコピー
+func (s *DirSink) CopyFile(file *dataset.File, relPath string) error {
+	return CopyFile(file, filepath.Join(s.root, filepath.FromSlash(relPath)))
+}
+
+// WriteFile はデータを出力ディレクトリへ書き込む
+func (s *DirSink) WriteFile(relPath string, data []byte) error {
+	destPath := filepath.Join(s.root, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(destPath, data, 0644)
+}
+
+// Close は何もしない
+func (s *DirSink) Close() error {
+	return nil
+}
+
+// S3Sink はS3互換オブジェクトストレージへ出力するSink
+// 出力先のプレフィックス以下に相対パスをキーとしてオブジェクトを書き込む
+type S3Sink struct {
+	client *storage.S3Client
+	bucket string
+	prefix string
+}
+
+// NewS3Sink はS3のプレフィックス（s3://bucket/prefix）へ出力するSinkを作成
+func NewS3Sink(client *storage.S3Client, dest string) (*S3Sink, error) {
+	bucket, prefix, err := storage.ParseS3URL(dest)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &S3Sink{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+// MkdirAll は何もしない（オブジェクトストレージにディレクトリはない）
+func (s *S3Sink) MkdirAll(relDir string) error {
+	return nil
+}
+
+// CopyFile はソースファイルを読み込んでオブジェクトとして書き込む
+func (s *S3Sink) CopyFile(file *dataset.File, relPath string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return s.client.Upload(s.bucket, s.prefix+filepath.ToSlash(relPath), src)
+}
+
+// WriteFile はデータをオブジェクトとして書き込む
+func (s *S3Sink) WriteFile(relPath string, data []byte) error {
+	return s.client.PutObject(s.bucket, s.prefix+filepath.ToSlash(relPath), data)
+}
+
+// Close は何もしない
+func (s *S3Sink) Close() error {
+	return nil
+}
+
+// archiveRequest はアーカイブ書き込みゴルーチンへの依頼
+type archiveRequest struct {
+	name string
+	info fs.FileInfo
+	r    io.Reader // ディレクトリの場合はnil
+	done chan error
+}
+
+// archiveMemoryLimit はアーカイブへ書き込む前にメモリへ読み込むエントリの最大サイズ
+// これを超えるファイルは一時ファイルへ読み込み、ワーカーごとのメモリ使用量を抑える
+var archiveMemoryLimit int64 = 4 << 20
+
+// entryBuffer は書き込みゴルーチンへ渡すまでエントリの内容を保持する
+type entryBuffer struct {
+	data []byte
+	file *os.File // archiveMemoryLimit を超える場合の一時ファイル
+}
+
+// bufferEntry はエントリの内容を読み込む（archiveMemoryLimit を超える場合は一時ファイルへ）
+func bufferEntry(r io.Reader) (*entryBuffer, error) {
+	data, err := io.ReadAll(io.LimitReader(r, archiveMemoryLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) <= archiveMemoryLimit {
+		return &entryBuffer{data: data}, nil
+	}
+
+	file, err := os.CreateTemp("", "dataset-splitter-entry-*")
+	if err != nil {
+		return nil, fmt.Errorf("一時ファイルの作成に失敗: %v", err)
+	}
+	b := &entryBuffer{file: file}
+	if _, err := io.Copy(file, io.MultiReader(bytes.NewReader(data), r)); err != nil {
+		b.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// reader は保持している内容を読み込むReaderを返す
+func (b *entryBuffer) reader() io.Reader {
+	if b.file != nil {
+		return b.file
+	}
+	return bytes.NewReader(b.data)
+}
+
+// Close は一時ファイルを削除する
+func (b *entryBuffer) Close() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+	}
+}
+
+// ArchiveSink は中間ディレクトリを作らずアーカイブへ直接出力するSink
+// 読み込みは各コピーワーカーで並列に行い、書き込みは単一のゴルーチンで直列化する
+// ワーカーは1エントリずつ読み込む（archiveMemoryLimit を超えるファイルは一時ファイルを経由する）
+// 再現可能モードではエントリを整列させるため、内容を一時ファイルへ書き出しておき、Close時に名前順で書き込む
+type ArchiveSink struct {
+	archive  *archiveFile
+	requests chan archiveRequest
+	finished chan error
+
+	spool *os.File // 再現可能モードでエントリの内容を保持する一時ファイル
+
+	mu        sync.Mutex
+	spoolSize int64       // 一時ファイル内で確保済みのサイズ
+	pending   []heldEntry // 再現可能モードで書き込みを保留しているエントリ
+	dirs      map[string]bool
+}
+
+// heldEntry は再現可能モードで書き込みを保留しているエントリ
+type heldEntry struct {
+	name   string
+	info   fs.FileInfo
+	offset int64 // 一時ファイル内の内容の位置（ディレクトリの場合は未使用）
+}
+
+// NewArchiveSink はアーカイブへ直接出力するSinkを作成
+func NewArchiveSink(archivePath string, opts ArchiveOptions) (*ArchiveSink, error) {
+	var spool *os.File
+	if opts.Reproducible {
+		var err error
+		if spool, err = os.CreateTemp("", "dataset-splitter-spool-*"); err != nil {
+			return nil, fmt.Errorf("一時ファイルの作成に失敗: %v", err)
+		}
+	}
+
+	archive, err := createArchiveFile(archivePath, opts)
+	if err != nil {
+		if spool != nil {
+			spool.Close()
+			os.Remove(spool.Name())
+		}
+		return nil, err
+	}
+
+	s := &ArchiveSink{
+		archive:  archive,
+		spool:    spool,
+		requests: make(chan archiveRequest),
+		finished: make(chan error, 1),
+		dirs:     make(map[string]bool),
+	}
+	go s.run()
+	return s, nil
+}
+
+// run はアーカイブへの書き込みを直列に処理
+func (s *ArchiveSink) run() {
+	var writeErr error
+
+	for req := range s.requests {
+		// 一度失敗したら以降の書き込みはすべて同じエラーを返す
+		if writeErr == nil {
+			writeErr = s.archive.writer.WriteEntry(req.name, req.info, req.r)
+		}
+		req.done <- writeErr
+	}
+
+	s.finished <- writeErr
+}
+
+// MkdirAll はディレクトリエントリを親から順に書き込む
+func (s *ArchiveSink) MkdirAll(relDir string) error {
+	relDir = path.Clean(filepath.ToSlash(relDir))
+	if relDir == "." || relDir == "/" {
+		return nil
+	}
+	if parent := path.Dir(relDir); parent != "." {
+		if err := s.MkdirAll(parent); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	if s.dirs[relDir] {
+		s.mu.Unlock()
+		return nil
+	}
+	s.dirs[relDir] = true
+	s.mu.Unlock()
+
+	info := entryInfo{name: path.Base(relDir), mode: fs.ModeDir | 0755, modTime: time.Now()}
+	if s.archive.opts.Reproducible {
+		s.hold(heldEntry{name: relDir, info: info})
+		return nil
+	}
+	return s.send(archiveRequest{name: relDir, info: info})
+}
+
+// CopyFile はソースファイルを読み込んでアーカイブへ書き込む
+func (s *ArchiveSink) CopyFile(src *dataset.File, relPath string) error {
+	name := filepath.ToSlash(relPath)
+
+	file, err := src.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if s.archive.opts.Reproducible {
+		return s.spoolEntry(name, info, file)
+	}
+
+	// ヘッダーのサイズはStatの値を使い、内容は読み込み終えてから書き込みゴルーチンへ渡す
+	buf, err := bufferEntry(file)
+	if err != nil {
+		return err
+	}
+	defer buf.Close()
+
+	return s.send(archiveRequest{name: name, info: info, r: buf.reader()})
+}
+
+// WriteFile はデータをアーカイブへ書き込む
+func (s *ArchiveSink) WriteFile(relPath string, data []byte) error {
+	name := filepath.ToSlash(relPath)
+	if parent := path.Dir(name); parent != "." {
+		if err := s.MkdirAll(parent); err != nil {
+			return err
+		}
+	}
+
+	info := entryInfo{name: path.Base(name), size: int64(len(data)), mode: 0644, modTime: time.Now()}
+	if s.archive.opts.Reproducible {
+		return s.spoolEntry(name, info, bytes.NewReader(data))
+	}
+	return s.send(archiveRequest{name: name, info: info, r: bytes.NewReader(data)})
+}
+
+// spoolEntry は再現可能モードでエントリの内容を一時ファイルへ書き出し、書き込みを保留する
+// 一時ファイル内の領域を確保してから書き込むため、各ワーカーは並列に読み込める
+func (s *ArchiveSink) spoolEntry(name string, info fs.FileInfo, r io.Reader) error {
+	size := info.Size()
+	s.mu.Lock()
+	offset := s.spoolSize
+	s.spoolSize += size
+	s.mu.Unlock()
+
+	n, err := io.CopyN(io.NewOffsetWriter(s.spool, offset), r, size)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if extra, _ := io.Copy(io.Discard, io.LimitReader(r, 1)); n != size || extra > 0 {
+		return fmt.Errorf("読み込み中にファイルのサイズが変わりました: %s", name)
+	}
+
+	s.hold(heldEntry{name: name, info: info, offset: offset})
+	return nil
+}
+
+// hold は再現可能モードでエントリの書き込みを保留する
+func (s *ArchiveSink) hold(entry heldEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, entry)
+}
+
+// send は書き込みゴルーチンへ依頼し、完了を待つ
+func (s *ArchiveSink) send(req archiveRequest) error {
+	req.done = make(chan error, 1)
+	s.requests <- req
+	return <-req.done
+}
+
+// Close は書き込みを終了し、アーカイブを確定させる
+func (s *ArchiveSink) Close() error {
+	close(s.requests)
+	writeErr := <-s.finished
+
+	// 保留していたエントリを整列し、一時ファイルから順に書き込む
+	if writeErr == nil && len(s.pending) > 0 {
+		sort.Slice(s.pending, func(i, j int) bool {
+			return s.pending[i].name < s.pending[j].name
+		})
+		for _, entry := range s.pending {
+			var r io.Reader
+			if !entry.info.IsDir() {
+				r = io.NewSectionReader(s.spool, entry.offset, entry.info.Size())
+			}
+			if writeErr = s.archive.writer.WriteEntry(entry.name, entry.info, r); writeErr != nil {
+				break
+			}
+		}
+	}
+	if s.spool != nil {
+		s.spool.Close()
+		os.Remove(s.spool.Name())
+	}
+
+	closeErr := s.archive.Close()
+	if writeErr != nil {
+		return fmt.Errorf("アーカイブへの書き込みに失敗: %v", writeErr)
+	}
+	return closeErr
+}
+
+// SplitArchiveSink は分割（train, validation など）ごとに個別のアーカイブへ出力するSink
+// 出力ルート直下のファイルはすべての分割のアーカイブに含める
+type SplitArchiveSink struct {
+	pathFor func(split string) string
+	opts    ArchiveOptions
+
+	mu        sync.Mutex
+	sinks     map[string]*ArchiveSink
+	order     []string
+	rootFiles []rootFile // 出力ルート直下のファイル（後から作成するアーカイブにも書き込む）
+}
+
+// rootFile は出力ルート直下に書き込んだファイル
+type rootFile struct {
+	name string
+	data []byte
+}
+
+// NewSplitArchiveSink は分割ごとにアーカイブへ出力するSinkを作成
+func NewSplitArchiveSink(pathFor func(split string) string, opts ArchiveOptions) *SplitArchiveSink {
+	return &SplitArchiveSink{
+		pathFor: pathFor,
+		opts:    opts,
+		sinks:   make(map[string]*ArchiveSink),
+	}
+}
+
+// sinkFor は分割に対応するSinkを返す（未作成なら作成）
+func (s *SplitArchiveSink) sinkFor(relPath string) (*ArchiveSink, error) {
+	split := splitOf(filepath.ToSlash(relPath))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sink, ok := s.sinks[split]; ok {
+		return sink, nil
+	}
+	sink, err := NewArchiveSink(s.pathFor(split), s.opts)
+	if err != nil {
+		return nil, err
+	}
+	s.sinks[split] = sink
+	s.order = append(s.order, split)
+
+	for _, file := range s.rootFiles {
+		if err := sink.WriteFile(file.name, file.data); err != nil {
+			return nil, err
+		}
+	}
+	return sink, nil
+}
+
+// MkdirAll は分割に対応するアーカイブへディレクトリエントリを書き込む
+func (s *SplitArchiveSink) MkdirAll(relDir string) error {
+	sink, err := s.sinkFor(relDir)
+	if err != nil {
+		return err
+	}
+	return sink.MkdirAll(relDir)
+}
+
+// CopyFile は分割に対応するアーカイブへファイルを書き込む
+func (s *SplitArchiveSink) CopyFile(file *dataset.File, relPath string) error {
+	sink, err := s.sinkFor(relPath)
+	if err != nil {
+		return err
+	}
+	return sink.CopyFile(file, relPath)
+}
+
+// WriteFile は分割に対応するアーカイブへデータを書き込む
+// 出力ルート直下のファイルは作成済みのすべての分割のアーカイブへ書き込み、以降に作成するアーカイブにも書き込む
+func (s *SplitArchiveSink) WriteFile(relPath string, data []byte) error {
+	name := filepath.ToSlash(relPath)
+	if strings.Contains(name, "/") {
+		sink, err := s.sinkFor(relPath)
+		if err != nil {
+			return err
+		}
+		return sink.WriteFile(relPath, data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rootFiles = append(s.rootFiles, rootFile{name: name, data: data})
+	for _, split := range s.order {
+		if err := s.sinks[split].WriteFile(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close はすべてのアーカイブを確定させる
+// 出力ルート直下のファイルがあるのに分割のアーカイブが1つも作成されなかった場合はエラーを返す
+func (s *SplitArchiveSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.order) == 0 && len(s.rootFiles) > 0 {
+		return fmt.Errorf("分割のアーカイブが作成されなかったため %s を書き込めませんでした", s.rootFiles[0].name)
+	}
+
+	var firstErr error
+	for _, split := range s.order {
+		if err := s.sinks[split].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// RecordedFile はコピーしたファイルと出力先パスの記録
+type RecordedFile struct {
+	RelPath string // 出力先ルートからの相対パス（スラッシュ区切り）
+	File    *dataset.File
+}
+
+// RecordingSink はコピーしたファイルと出力先パスを記録するSink
+type RecordingSink struct {
+	Sink
+
+	mu      sync.Mutex
+	records []RecordedFile
+}
+
+// NewRecordingSink は出力先パスを記録するSinkを作成
+func NewRecordingSink(sink Sink) *RecordingSink {
+	return &RecordingSink{Sink: sink}
+}
+
+// CopyFile はファイルをコピーし、成功した場合に出力先パスを記録
+func (s *RecordingSink) CopyFile(file *dataset.File, relPath string) error {
+	if err := s.Sink.CopyFile(file, relPath); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, RecordedFile{RelPath: filepath.ToSlash(relPath), File: file})
+	return nil
+}
+
+// Records は記録を出力先パス順に整列して返す
+func (s *RecordingSink) Records() []RecordedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := append([]RecordedFile(nil), s.records...)
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].RelPath < records[j].RelPath
+	})
+	return records
+}
+
+// entryInfo はアーカイブ内で合成するエントリ用のFileInfo
+type entryInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (e entryInfo) Name() string       { return e.name }
+func (e entryInfo) Size() int64        { return e.size }
+func (e entryInfo) Mode() fs.FileMode  { return e.mode }
+func (e entryInfo) ModTime() time.Time { return e.modTime }
+func (e entryInfo) IsDir() bool        { return e.mode.IsDir() }
+func (e entryInfo) Sys() interface{}   { return nil }
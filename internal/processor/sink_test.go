@@ -0,0 +1,349 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+)
+
+// testSourceFS はサイズの異なるファイルを含むソース
+func testSourceFS(count int) fstest.MapFS {
+	fsys := make(fstest.MapFS)
+	for i := 0; i < count; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i%26)}, 100+i*37)
+		fsys[fmt.Sprintf("A/A1/%03d.jpg", i)] = &fstest.MapFile{Data: data, Mode: 0644}
+	}
+	return fsys
+}
+
+// readArchive はアーカイブ内のファイル（ディレクトリを除く）の名前と内容を返す
+func readArchive(t *testing.T, p, format string) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+
+	if format == config.ArchiveZip {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			t.Fatalf("zipを開けません: %v", err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if strings.HasSuffix(f.Name, "/") {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatalf("%sの読み込みに失敗: %v", f.Name, err)
+			}
+			entries[f.Name] = string(data)
+		}
+		return entries
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if format == config.ArchiveTarGz {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("gzipを開けません: %v", err)
+		}
+		r = gr
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tarの読み込みに失敗: %v", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("%sの読み込みに失敗: %v", header.Name, err)
+		}
+		entries[header.Name] = string(data)
+	}
+	return entries
+}
+
+// TestArchiveSinkConcurrentCopy は複数のワーカーから同時に書き込んだ内容がすべてアーカイブに含まれることを確認する
+func TestArchiveSinkConcurrentCopy(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		memoryLimit int64
+	}{
+		{name: "tar", format: config.ArchiveTar, memoryLimit: 4 << 20},
+		{name: "tar.gz", format: config.ArchiveTarGz, memoryLimit: 4 << 20},
+		{name: "zip", format: config.ArchiveZip, memoryLimit: 4 << 20},
+		{name: "tar（一時ファイル経由）", format: config.ArchiveTar, memoryLimit: 512},
+		{name: "zip（一時ファイル経由）", format: config.ArchiveZip, memoryLimit: 512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(limit int64) { archiveMemoryLimit = limit }(archiveMemoryLimit)
+			archiveMemoryLimit = tt.memoryLimit
+
+			fsys := testSourceFS(40)
+			archivePath := filepath.Join(t.TempDir(), "out."+tt.format)
+			sink, err := NewArchiveSink(archivePath, ArchiveOptions{Format: tt.format, Level: flate.DefaultCompression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.MkdirAll("train/A1"); err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, len(fsys))
+			for name := range fsys {
+				wg.Add(1)
+				go func(name string) {
+					defer wg.Done()
+					file := &dataset.File{FS: fsys, Path: name}
+					errs <- sink.CopyFile(file, "train/A1/"+file.OutputName())
+				}(name)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("コピーに失敗: %v", err)
+				}
+			}
+			if err := sink.WriteFile("classes.txt", []byte("A1\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			entries := readArchive(t, archivePath, tt.format)
+			if len(entries) != len(fsys)+1 {
+				t.Errorf("エントリ数 = %d, want %d", len(entries), len(fsys)+1)
+			}
+			for name, file := range fsys {
+				got := entries["train/A1/"+filepath.Base(name)]
+				if got != string(file.Data) {
+					t.Errorf("%s の内容が一致しません（%dバイト, want %dバイト）", name, len(got), len(file.Data))
+				}
+			}
+			if entries["classes.txt"] != "A1\n" {
+				t.Errorf("classes.txt = %q", entries["classes.txt"])
+			}
+		})
+	}
+}
+
+// buildDirectArchive はソースを並列にコピーしてアーカイブへ直接出力する
+func buildDirectArchive(t *testing.T, fsys fstest.MapFS, archivePath string, opts ArchiveOptions) {
+	t.Helper()
+	sink, err := NewArchiveSink(archivePath, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(fsys))
+	for name := range fsys {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			file := &dataset.File{FS: fsys, Path: name}
+			if err := sink.MkdirAll("train/A1"); err != nil {
+				errs <- err
+				return
+			}
+			errs <- sink.CopyFile(file, "train/A1/"+file.OutputName())
+		}(name)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("コピーに失敗: %v", err)
+		}
+	}
+	if err := sink.WriteFile("train.txt", []byte("train/A1/000.jpg 0\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// buildDirArchive はソースをディレクトリへ書き出してからアーカイブを作成する
+func buildDirArchive(t *testing.T, fsys fstest.MapFS, archivePath string, opts ArchiveOptions) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, file := range fsys {
+		p := filepath.Join(dir, "train", filepath.Base(filepath.Dir(name)), filepath.Base(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, file.Data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, file.ModTime, file.ModTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "train.txt"), []byte("train/A1/000.jpg 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateArchive(dir, "", archivePath, opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReproducibleArchive は再現可能モードで同じ内容から作成したアーカイブとチェックサムファイルが
+// 更新日時・書き込み順に関係なく一致することを確認する
+func TestReproducibleArchive(t *testing.T) {
+	builders := []struct {
+		name  string
+		build func(*testing.T, fstest.MapFS, string, ArchiveOptions)
+	}{
+		{name: "直接出力", build: buildDirectArchive},
+		{name: "ディレクトリから作成", build: buildDirArchive},
+	}
+	formats := []string{config.ArchiveTar, config.ArchiveTarGz, config.ArchiveZip}
+
+	for _, builder := range builders {
+		for _, format := range formats {
+			t.Run(builder.name+"/"+format, func(t *testing.T) {
+				opts := ArchiveOptions{Format: format, Level: flate.DefaultCompression, Reproducible: true}
+
+				var archives, sidecars [2][]byte
+				var archivePath string
+				for run := 0; run < 2; run++ {
+					fsys := testSourceFS(30)
+					for _, file := range fsys {
+						file.ModTime = time.Date(2020+run, 1, 2, 3, 4, 5, 0, time.UTC)
+					}
+					archivePath = filepath.Join(t.TempDir(), "out."+format)
+					builder.build(t, fsys, archivePath, opts)
+
+					var err error
+					if archives[run], err = os.ReadFile(archivePath); err != nil {
+						t.Fatal(err)
+					}
+					if sidecars[run], err = os.ReadFile(archivePath + ".sha256"); err != nil {
+						t.Fatalf("チェックサムファイルがありません: %v", err)
+					}
+				}
+
+				if !bytes.Equal(archives[0], archives[1]) {
+					t.Errorf("アーカイブの内容が一致しません（%dバイト, %dバイト）", len(archives[0]), len(archives[1]))
+				}
+				if !bytes.Equal(sidecars[0], sidecars[1]) {
+					t.Errorf("チェックサムが一致しません: %q, %q", sidecars[0], sidecars[1])
+				}
+				if got := len(readArchive(t, archivePath, format)); got != 31 {
+					t.Errorf("エントリ数 = %d, want 31", got)
+				}
+			})
+		}
+	}
+}
+
+// TestSplitArchiveSinkRootFiles は出力ルート直下のファイルが、書き込んだ時点に関係なくすべての分割のアーカイブに含まれることを確認する
+func TestSplitArchiveSinkRootFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  []string // 出力ルート直下のファイルより前にコピーする分割
+		after   []string // 出力ルート直下のファイルより後にコピーする分割
+		wantErr bool
+	}{
+		{name: "分割の後に書き込む", before: []string{"train", "validation"}},
+		{name: "分割の前に書き込む", after: []string{"train", "validation"}},
+		{name: "分割の間に書き込む", before: []string{"train"}, after: []string{"validation"}},
+		{name: "分割がない", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			pathFor := func(split string) string { return filepath.Join(dir, split+".tar") }
+			sink := NewSplitArchiveSink(pathFor, ArchiveOptions{Format: config.ArchiveTar})
+			fsys := testSourceFS(10)
+
+			copySplits := func(splits []string) {
+				var wg sync.WaitGroup
+				for _, split := range splits {
+					for name := range fsys {
+						wg.Add(1)
+						go func(split, name string) {
+							defer wg.Done()
+							file := &dataset.File{FS: fsys, Path: name}
+							if err := sink.CopyFile(file, split+"/A1/"+file.OutputName()); err != nil {
+								t.Errorf("コピーに失敗: %v", err)
+							}
+						}(split, name)
+					}
+				}
+				// 同時に出力ルート直下のファイルも書き込む
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := sink.WriteFile("during.txt", []byte("during")); err != nil {
+						t.Errorf("書き込みに失敗: %v", err)
+					}
+				}()
+				wg.Wait()
+			}
+
+			copySplits(tt.before)
+			if err := sink.WriteFile("classes.txt", []byte("A1\n")); err != nil {
+				t.Fatal(err)
+			}
+			copySplits(tt.after)
+
+			err := sink.Close()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("エラーになりません")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, split := range append(tt.before, tt.after...) {
+				entries := readArchive(t, pathFor(split), config.ArchiveTar)
+				if entries["classes.txt"] != "A1\n" || entries["during.txt"] != "during" {
+					t.Errorf("%s: 出力ルート直下のファイルがありません: classes.txt=%q during.txt=%q", split, entries["classes.txt"], entries["during.txt"])
+				}
+				if got := len(entries); got != len(fsys)+2 {
+					t.Errorf("%s: エントリ数 = %d, want %d", split, got, len(fsys)+2)
+				}
+			}
+		})
+	}
+}
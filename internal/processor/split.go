@@ -0,0 +1,50 @@
+package processor
+
+import "dataset-splitter/internal/dataset"
+
+// SplitFiles はファイル群を教師データと検証データに分割
+// グループが設定されたファイルは同じグループ同士が同じ分割になるよう、グループ単位で割り当てる
+func SplitFiles(files []*dataset.File, trainingRatio float64) ([]*dataset.File, []*dataset.File) {
+	trainingCount := int(float64(len(files)) * trainingRatio)
+
+	if !hasGroups(files) {
+		return files[:trainingCount], files[trainingCount:]
+	}
+
+	// グループを初出順にまとめる（グループなしのファイルは単独のグループとして扱う）
+	var groups [][]*dataset.File
+	groupIndex := make(map[string]int)
+	for _, file := range files {
+		if file.Group == "" {
+			groups = append(groups, []*dataset.File{file})
+			continue
+		}
+		if i, ok := groupIndex[file.Group]; ok {
+			groups[i] = append(groups[i], file)
+			continue
+		}
+		groupIndex[file.Group] = len(groups)
+		groups = append(groups, []*dataset.File{file})
+	}
+
+	// 教師データ数が目標に達するまでグループ単位で割り当てる
+	var trainingFiles, validationFiles []*dataset.File
+	for _, group := range groups {
+		if len(trainingFiles) < trainingCount {
+			trainingFiles = append(trainingFiles, group...)
+		} else {
+			validationFiles = append(validationFiles, group...)
+		}
+	}
+	return trainingFiles, validationFiles
+}
+
+// hasGroups はグループが設定されたファイルを含むかどうかを返す
+func hasGroups(files []*dataset.File) bool {
+	for _, file := range files {
+		if file.Group != "" {
+			return true
+		}
+	}
+	return false
+}
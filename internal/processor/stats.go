@@ -0,0 +1,386 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// resolutionBucket は解像度分布の区分（短辺のピクセル数で分類）
+type resolutionBucket struct {
+	Label string
+	Upper int // 短辺がこの値未満なら該当（0は上限なし）
+}
+
+// resolutionBuckets は解像度分布の区分（小さい順）
+var resolutionBuckets = []resolutionBucket{
+	{"<128", 128},
+	{"128-255", 256},
+	{"256-511", 512},
+	{"512-1023", 1024},
+	{"1024-2047", 2048},
+	{"2048+", 0},
+}
+
+// resolutionUnknown は解像度を読み込めなかったファイルの区分
+const resolutionUnknown = "不明"
+
+// SubclassStats はサブクラスごとの統計
+type SubclassStats struct {
+	Name          string         `json:"subclass"`
+	Files         int            `json:"files"`
+	Bytes         int64          `json:"bytes"`
+	Formats       map[string]int `json:"formats"`
+	Resolutions   map[string]int `json:"resolutions"` // 短辺の区分ごとの件数
+	ColorModes    map[string]int `json:"color_modes"` // 色モードごとの件数（読み込めた画像のみ）
+	Skipped       map[string]int `json:"skipped,omitempty"`
+	BelowMinFiles bool           `json:"below_min_files"` // 最小ファイル数未満のため分割時にスキップされる
+}
+
+// ClassStats はクラスごとの統計
+type ClassStats struct {
+	Name       string          `json:"class"`
+	Files      int             `json:"files"`
+	Bytes      int64           `json:"bytes"`
+	Imbalance  float64         `json:"imbalance"` // 分割対象のサブクラスの最大ファイル数÷最小ファイル数
+	Subclasses []SubclassStats `json:"subclasses"`
+}
+
+// DatasetStats はデータセット全体の統計
+type DatasetStats struct {
+	Files          int            `json:"files"`
+	Bytes          int64          `json:"bytes"`
+	Formats        map[string]int `json:"formats"`
+	Resolutions    map[string]int `json:"resolutions"`
+	ColorModes     map[string]int `json:"color_modes"`
+	Imbalance      float64        `json:"imbalance"`       // 分割対象のサブクラス全体での最大ファイル数÷最小ファイル数
+	ClassImbalance float64        `json:"class_imbalance"` // クラスの最大ファイル数÷最小ファイル数
+	MinFileCount   int            `json:"min_file_count"`
+	BelowMinFiles  []string       `json:"below_min_files"` // 最小ファイル数未満のサブクラス（クラス/サブクラス）
+	Classes        []ClassStats   `json:"classes"`
+}
+
+// CollectStats はクラス・サブクラスごとのファイル数・サイズ・解像度分布・形式の内訳を集計
+func CollectStats(classes []*dataset.Class, minFileCount, maxWorkers int) *DatasetStats {
+	ReadDimensions(classes, maxWorkers)
+
+	stats := &DatasetStats{
+		Formats:       make(map[string]int),
+		Resolutions:   make(map[string]int),
+		ColorModes:    make(map[string]int),
+		MinFileCount:  minFileCount,
+		BelowMinFiles: []string{},
+	}
+	var allCounts, classCounts []int
+	for _, class := range classes {
+		classStats := ClassStats{Name: class.Name}
+		var counts []int
+		for _, sub := range class.Subclasses {
+			subStats := SubclassStats{
+				Name:          sub.Name,
+				Files:         len(sub.Files),
+				Formats:       make(map[string]int),
+				Resolutions:   make(map[string]int),
+				ColorModes:    make(map[string]int),
+				Skipped:       sub.Skipped,
+				BelowMinFiles: len(sub.Files) < minFileCount,
+			}
+			for _, file := range sub.Files {
+				if info, err := fs.Stat(file.FS, file.Path); err == nil {
+					subStats.Bytes += info.Size()
+				} else {
+					log.Printf("警告: ファイル情報を取得できません: %s: %v", file.Path, err)
+				}
+				format := fileFormat(file)
+				resolution := resolutionLabel(file)
+				subStats.Formats[format]++
+				subStats.Resolutions[resolution]++
+				stats.Formats[format]++
+				stats.Resolutions[resolution]++
+				if file.ColorMode != "" {
+					subStats.ColorModes[file.ColorMode]++
+					stats.ColorModes[file.ColorMode]++
+				}
+			}
+
+			if subStats.BelowMinFiles {
+				stats.BelowMinFiles = append(stats.BelowMinFiles, class.Name+"/"+sub.Name)
+			} else {
+				counts = append(counts, subStats.Files)
+			}
+			classStats.Files += subStats.Files
+			classStats.Bytes += subStats.Bytes
+			classStats.Subclasses = append(classStats.Subclasses, subStats)
+		}
+		classStats.Imbalance = imbalance(counts)
+		allCounts = append(allCounts, counts...)
+		classCounts = append(classCounts, classStats.Files)
+
+		stats.Files += classStats.Files
+		stats.Bytes += classStats.Bytes
+		stats.Classes = append(stats.Classes, classStats)
+	}
+	stats.Imbalance = imbalance(allCounts)
+	stats.ClassImbalance = imbalance(classCounts)
+	return stats
+}
+
+// fileFormat はファイルの形式（拡張子から判定。不明な場合は拡張子）を返す
+func fileFormat(file *dataset.File) string {
+	ext := strings.ToLower(path.Ext(file.OutputName()))
+	if kind := utils.ExpectedKind(ext); kind != "" {
+		return kind
+	}
+	if ext == "" {
+		return "(拡張子なし)"
+	}
+	return strings.TrimPrefix(ext, ".")
+}
+
+// resolutionLabel はファイルの解像度の区分を返す
+func resolutionLabel(file *dataset.File) string {
+	if file.Width == 0 {
+		return resolutionUnknown
+	}
+	short := min(file.Width, file.Height)
+	for _, bucket := range resolutionBuckets {
+		if bucket.Upper == 0 || short < bucket.Upper {
+			return bucket.Label
+		}
+	}
+	return resolutionUnknown
+}
+
+// imbalance はファイル数の最大÷最小を返す（ファイル数が0件のものは除く。対象がなければ0）
+func imbalance(counts []int) float64 {
+	lowest, highest := 0, 0
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if lowest == 0 || n < lowest {
+			lowest = n
+		}
+		highest = max(highest, n)
+	}
+	if lowest == 0 {
+		return 0
+	}
+	return float64(highest) / float64(lowest)
+}
+
+// WriteStats は統計を指定した形式（config.StatsTable, config.StatsJSON, config.StatsMarkdown）で出力
+func WriteStats(w io.Writer, stats *DatasetStats, format string) error {
+	switch format {
+	case config.StatsJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(stats)
+	case config.StatsMarkdown:
+		return writeStatsMarkdown(w, stats)
+	default:
+		return writeStatsTable(w, stats)
+	}
+}
+
+// writeStatsTable は統計を整形したテキストの表で出力
+func writeStatsTable(w io.Writer, stats *DatasetStats) error {
+	rows := [][]string{{"クラス", "サブクラス", "ファイル数", "サイズ", "形式", "解像度（短辺）", "備考"}}
+	for _, class := range stats.Classes {
+		for _, sub := range class.Subclasses {
+			rows = append(rows, []string{class.Name, sub.Name, fmt.Sprint(sub.Files), formatBytes(sub.Bytes),
+				formatCounts(sub.Formats, nil), formatCounts(sub.Resolutions, resolutionOrder()), subclassNote(sub, stats.MinFileCount)})
+		}
+		rows = append(rows, []string{class.Name, "(計)", fmt.Sprint(class.Files), formatBytes(class.Bytes), "", "", "偏り " + formatRatio(class.Imbalance)})
+	}
+	if err := writeAligned(w, rows); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	for _, line := range statsSummary(stats) {
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// writeAligned は表示幅（全角文字は2桁）を揃えて表を出力
+func writeAligned(w io.Writer, rows [][]string) error {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// displayWidth は端末での表示幅を返す（全角文字は2桁とする）
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case r >= 0x1100 && r <= 0x115F, r >= 0x2E80 && r <= 0xA4CF, r >= 0xAC00 && r <= 0xD7A3,
+			r >= 0xF900 && r <= 0xFAFF, r >= 0xFE30 && r <= 0xFE4F, r >= 0xFF00 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6:
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+// writeStatsMarkdown は統計をMarkdownの表で出力
+func writeStatsMarkdown(w io.Writer, stats *DatasetStats) error {
+	fmt.Fprintln(w, "## データセットの統計")
+	fmt.Fprintln(w)
+	for _, line := range statsSummary(stats) {
+		fmt.Fprintf(w, "- %s\n", line)
+	}
+
+	for _, class := range stats.Classes {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "### %s\n", markdownEscape(class.Name))
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "ファイル数 %d, サイズ %s, 偏り %s\n", class.Files, formatBytes(class.Bytes), formatRatio(class.Imbalance))
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| サブクラス | ファイル数 | サイズ | 形式 | 解像度（短辺） | 備考 |")
+		fmt.Fprintln(w, "|------------|-----------:|-------:|------|----------------|------|")
+		for _, sub := range class.Subclasses {
+			fmt.Fprintf(w, "| %s | %d | %s | %s | %s | %s |\n", markdownEscape(sub.Name), sub.Files, formatBytes(sub.Bytes),
+				formatCounts(sub.Formats, nil), markdownEscape(formatCounts(sub.Resolutions, resolutionOrder())), subclassNote(sub, stats.MinFileCount))
+		}
+	}
+	return nil
+}
+
+// statsSummary はデータセット全体の統計の行を返す
+func statsSummary(stats *DatasetStats) []string {
+	lines := []string{
+		fmt.Sprintf("合計: %dクラス, %d件, %s", len(stats.Classes), stats.Files, formatBytes(stats.Bytes)),
+		fmt.Sprintf("形式: %s", formatCounts(stats.Formats, nil)),
+		fmt.Sprintf("解像度（短辺）: %s", formatCounts(stats.Resolutions, resolutionOrder())),
+	}
+	if len(stats.ColorModes) > 0 {
+		lines = append(lines, fmt.Sprintf("色モード: %s", formatCounts(stats.ColorModes, nil)))
+	}
+	lines = append(lines, fmt.Sprintf("偏り（最大÷最小）: サブクラス %s, クラス %s", formatRatio(stats.Imbalance), formatRatio(stats.ClassImbalance)))
+	if len(stats.BelowMinFiles) == 0 {
+		lines = append(lines, fmt.Sprintf("最小ファイル数 %d 未満でスキップされるサブクラス: なし", stats.MinFileCount))
+	} else {
+		lines = append(lines, fmt.Sprintf("最小ファイル数 %d 未満でスキップされるサブクラス: %s", stats.MinFileCount, strings.Join(stats.BelowMinFiles, ", ")))
+	}
+	return lines
+}
+
+// subclassNote はサブクラスの備考（スキップ・除外件数・8ビットRGB以外の画像の件数）を返す
+func subclassNote(sub SubclassStats, minFileCount int) string {
+	var notes []string
+	if sub.BelowMinFiles {
+		notes = append(notes, fmt.Sprintf("スキップ（%d件未満）", minFileCount))
+	}
+	if len(sub.Skipped) > 0 {
+		notes = append(notes, "除外: "+formatCounts(sub.Skipped, nil))
+	}
+	other := make(map[string]int)
+	for mode, n := range sub.ColorModes {
+		if mode != ColorModeRGB {
+			other[mode] = n
+		}
+	}
+	if len(other) > 0 {
+		notes = append(notes, "RGB以外: "+formatCounts(other, nil))
+	}
+	return strings.Join(notes, ", ")
+}
+
+// resolutionOrder は解像度の区分の表示順を返す
+func resolutionOrder() []string {
+	order := make([]string, 0, len(resolutionBuckets)+1)
+	for _, bucket := range resolutionBuckets {
+		order = append(order, bucket.Label)
+	}
+	return append(order, resolutionUnknown)
+}
+
+// formatCounts は件数を「名前 件数」のカンマ区切りで返す
+// orderがnilの場合は件数の多い順（同数なら名前順）とする
+func formatCounts(counts map[string]int, order []string) string {
+	if order == nil {
+		for name := range counts {
+			order = append(order, name)
+		}
+		sort.Slice(order, func(i, j int) bool {
+			if counts[order[i]] != counts[order[j]] {
+				return counts[order[i]] > counts[order[j]]
+			}
+			return order[i] < order[j]
+		})
+	}
+
+	var parts []string
+	for _, name := range order {
+		if counts[name] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", name, counts[name]))
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatRatio は偏りの比率を表示用の文字列で返す
+func formatRatio(ratio float64) string {
+	if ratio == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", ratio)
+}
+
+// formatBytes はバイト数を表示用の文字列（KiB, MiB, GiB）で返す
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	for _, suffix := range []string{"KiB", "MiB", "GiB"} {
+		value /= unit
+		if value < unit || suffix == "GiB" {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// markdownEscape はMarkdownの表で特別な意味を持つ文字をエスケープ
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "<", "&lt;").Replace(s)
+}
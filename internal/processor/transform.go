@@ -0,0 +1,437 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// 変換の種類（件数の集計に使用）
+const (
+	transformOriented    = "向きを反映"
+	transformStripped    = "メタデータを削除"
+	transformResized     = "リサイズ"
+	transformReencoded   = "再エンコード"
+	transformUnsupported = "未対応の形式のためそのまま"
+	transformColor       = "8ビットRGBに変換"
+	transformColorKept   = "8ビットRGBに変換できないためそのまま"
+)
+
+// TransformOptions はコピー時の変換の設定
+type TransformOptions struct {
+	ApplyOrientation bool          // JPEGのEXIFの向きを画素に反映
+	StripMetadata    bool          // EXIF（位置情報を含む）・XMP・IPTCを取り除く
+	Resize           ResizeOptions // リサイズ
+	Encode           string        // 再エンコードする形式（空: 元の形式）
+	Quality          int           // JPEGの品質 (1-100)
+	ColorMode        string        // 色モード（空: そのまま, rgb, gray）
+	ConvertToRGB     bool          // 8ビットRGB以外の画像（色モードの検査で判定したもの）を8ビットRGBに変換
+}
+
+// NewTransformOptions は設定からコピー時の変換の設定を作成
+func NewTransformOptions(cfg *config.Config) TransformOptions {
+	width, height, _ := cfg.GetResizeSize()
+	return TransformOptions{
+		ApplyOrientation: cfg.ApplyOrientation,
+		StripMetadata:    cfg.StripMetadata,
+		Resize: ResizeOptions{
+			MaxSide: cfg.MaxSide,
+			Width:   width,
+			Height:  height,
+			Mode:    cfg.ResizeMode,
+		},
+		Encode:       cfg.Encode,
+		Quality:      cfg.Quality,
+		ColorMode:    cfg.ColorMode,
+		ConvertToRGB: cfg.ColorCheck == config.ColorCheckConvert,
+	}
+}
+
+// Enabled は変換が1つでも指定されているかを返す
+func (o TransformOptions) Enabled() bool {
+	return o.ApplyOrientation || o.StripMetadata || o.ConvertToRGB || o.decodes()
+}
+
+// decodes は画素の処理（リサイズ・再エンコード・色モードの変換）が必要かを返す
+func (o TransformOptions) decodes() bool {
+	return o.Resize.Enabled() || o.Encode != "" || o.ColorMode != ""
+}
+
+// reencodes は形式kindの画像を画素の処理の対象とするかを返す
+// 標準ライブラリでデコードできる形式が対象（GIFは再エンコードする形式の指定が必要）
+func (o TransformOptions) reencodes(kind string) bool {
+	if !o.decodes() || !decodableKinds[kind] {
+		return false
+	}
+	return kind != utils.KindGIF || o.Encode != ""
+}
+
+// EncodedExtension は形式kindの画像を再エンコードした場合の拡張子を返す（拡張子が変わらない場合は空文字）
+func (o TransformOptions) EncodedExtension(kind string) string {
+	if !o.reencodes(kind) || o.Encode == "" || o.Encode == kind {
+		return ""
+	}
+	if o.Encode == config.EncodeJPEG {
+		return ".jpg"
+	}
+	return "." + o.Encode
+}
+
+// transformableKinds はコピー時に変換できる形式
+var transformableKinds = map[string]bool{
+	utils.KindJPEG: true,
+	utils.KindPNG:  true,
+	utils.KindGIF:  true,
+	utils.KindWebP: true,
+}
+
+// sourceKind はソースファイルの形式を拡張子から判定
+// 出力ファイル名の拡張子は再エンコード後の形式に変わっている場合があるため、ソースのパスの拡張子を優先する
+func sourceKind(file *dataset.File) string {
+	if kind := utils.ExpectedKind(path.Ext(file.Path)); kind != "" {
+		return kind
+	}
+	return utils.ExpectedKind(path.Ext(file.OutputName()))
+}
+
+// RenameForEncoding は再エンコードで拡張子が変わるファイルの出力ファイル名を変更し、変更した件数を返す
+// 同じサブクラス内で出力ファイル名が重複する場合は元の拡張子を名前に含める（a.png → a_png.jpg）
+func RenameForEncoding(classes []*dataset.Class, opts TransformOptions) int {
+	renamed := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			used := make(map[string]bool, len(sub.Files))
+			for _, file := range sub.Files {
+				used[file.OutputName()] = true
+			}
+			for _, file := range sub.Files {
+				ext := opts.EncodedExtension(sourceKind(file))
+				if ext == "" {
+					continue
+				}
+				name := file.OutputName()
+				base := strings.TrimSuffix(name, path.Ext(name))
+				newName := base + ext
+				if used[newName] {
+					newName = base + "_" + strings.TrimPrefix(strings.ToLower(path.Ext(name)), ".") + ext
+				}
+				for i := 2; used[newName]; i++ {
+					newName = fmt.Sprintf("%s_%d%s", base, i, ext)
+				}
+				delete(used, name)
+				used[newName] = true
+				file.Name = newName
+				renamed++
+			}
+		}
+	}
+	if renamed > 0 {
+		log.Printf("再エンコードにより出力ファイル名の拡張子を変更: %d件", renamed)
+	}
+	return renamed
+}
+
+// TransformSink はコピー時にファイルの内容を変換してから出力するSink
+// 変換が不要なファイルはそのままコピーする
+type TransformSink struct {
+	Sink
+	opts TransformOptions
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// NewTransformSink はコピー時に変換するSinkを作成
+func NewTransformSink(sink Sink, opts TransformOptions) *TransformSink {
+	return &TransformSink{Sink: sink, opts: opts, counts: make(map[string]int)}
+}
+
+// CopyFile はファイルを変換して書き込む（変換が不要な場合はそのままコピー）
+func (s *TransformSink) CopyFile(file *dataset.File, relPath string) error {
+	kind := sourceKind(file)
+	if !transformableKinds[kind] {
+		s.count(transformUnsupported)
+		return s.Sink.CopyFile(file, relPath)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	// 拡張子と内容の形式が異なる場合は内容の形式に従う
+	if sniffed := utils.SniffKind(data); transformableKinds[sniffed] {
+		kind = sniffed
+	}
+
+	// 8ビットRGB以外の画像は色モードの変換を加える（色モードの指定がある場合はそちらに従う）
+	opts := s.opts
+	if opts.ConvertToRGB && opts.ColorMode == "" && needsRGBConversion(file) {
+		opts.ColorMode = config.ColorRGB
+		if !opts.reencodes(kind) {
+			s.count(transformColorKept)
+			opts = s.opts
+		}
+	}
+
+	var transformed []byte
+	var applied []string
+	switch {
+	case opts.reencodes(kind):
+		transformed, applied, err = opts.reencode(data, kind)
+	case kind == utils.KindJPEG:
+		transformed, applied, err = opts.transformJPEG(data)
+	case kind == utils.KindPNG:
+		if opts.StripMetadata {
+			transformed, err = stripPNGMetadata(data)
+			applied = []string{transformStripped}
+		}
+	case kind == utils.KindWebP:
+		if opts.StripMetadata {
+			transformed, err = stripWebPMetadata(data)
+			applied = []string{transformStripped}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("変換に失敗: %v", err)
+	}
+	if transformed == nil {
+		// 変換が不要な場合は元のファイル情報を保つためそのままコピー
+		return s.Sink.CopyFile(file, relPath)
+	}
+
+	for _, name := range applied {
+		s.count(name)
+	}
+	if opts.ColorMode != s.opts.ColorMode {
+		s.count(transformColor)
+	}
+	return s.Sink.WriteFile(relPath, transformed)
+}
+
+// transformJPEG はJPEGに向きの反映・メタデータの削除を行う
+// 向きを反映せずにメタデータを削除する場合は、表示が変わらないよう向きのみを含むExifを残す
+// 変換しない場合はnilを返す
+func (o TransformOptions) transformJPEG(data []byte) ([]byte, []string, error) {
+	segments, scan, err := parseJPEG(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orientation, exifIndex, _ := jpegOrientation(segments)
+	if o.ApplyOrientation && orientation > 1 {
+		return o.reencode(data, utils.KindJPEG)
+	}
+
+	if !o.StripMetadata {
+		return nil, nil, nil
+	}
+	kept := make([]jpegSegment, 0, len(segments))
+	changed := false
+	for i, segment := range segments {
+		if !segment.isMetadata() {
+			kept = append(kept, segment)
+			continue
+		}
+		if i == exifIndex && orientation > 1 {
+			// 画素に反映していない向きは失われないよう残す
+			minimal := orientationSegment(orientation)
+			kept = append(kept, minimal)
+			changed = changed || !bytes.Equal(minimal.data, segment.data)
+			continue
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, nil, nil
+	}
+	return buildJPEG(kept, scan), []string{transformStripped}, nil
+}
+
+// reencode は画像をデコードし、向きの反映・リサイズ・色モードの変換を行って再エンコードする
+// JPEGからJPEGへの再エンコードでは元のAPPセグメント（ICCプロファイルなど）を引き継ぎ、
+// Exifの向きを反映した場合は向きを1に書き換える（メタデータを削除する場合はExif・XMP・IPTCを引き継がない）
+// メタデータを削除し向きを反映しない場合は、向きのみを含むExifを残す
+// Adobeセグメント（色変換の指定）と、色モードを変換した場合のICCプロファイルは元の色空間を表すため引き継がない
+func (o TransformOptions) reencode(data []byte, kind string) ([]byte, []string, error) {
+	var segments []jpegSegment
+	orientation, exifIndex, offset := 0, -1, 0
+	if kind == utils.KindJPEG {
+		var err error
+		if segments, _, err = parseJPEG(data); err != nil {
+			return nil, nil, err
+		}
+		orientation, exifIndex, offset = jpegOrientation(segments)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var applied []string
+	if o.ApplyOrientation && orientation > 1 {
+		img = applyOrientation(img, orientation)
+		applied = append(applied, transformOriented)
+	}
+	if o.Resize.Enabled() {
+		before := img.Bounds().Size()
+		img = resizeImage(img, o.Resize)
+		if img.Bounds().Size() != before {
+			applied = append(applied, transformResized)
+		}
+	}
+
+	format := o.Encode
+	if format == "" {
+		format = kind
+	}
+	if len(applied) == 0 && format == kind && o.ColorMode == "" {
+		// 画素も形式も変わらない場合は再エンコードしない（メタデータの削除のみ行う）
+		if kind == utils.KindJPEG {
+			return o.transformJPEG(data)
+		}
+		if kind == utils.KindPNG && o.StripMetadata {
+			transformed, err := stripPNGMetadata(data)
+			return transformed, []string{transformStripped}, err
+		}
+		return nil, nil, nil
+	}
+	switch {
+	case o.ColorMode != "":
+		img = convertColorMode(img, o.ColorMode)
+	case format == config.EncodeJPEG && hasAlpha(img):
+		// JPEGは透過を扱えないため白で合成する
+		img = convertColorMode(img, config.ColorRGB)
+	}
+
+	var encoded bytes.Buffer
+	if format == config.EncodeJPEG {
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: o.Quality})
+	} else {
+		err = png.Encode(&encoded, img)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	applied = append(applied, transformReencoded)
+
+	if format != config.EncodeJPEG || kind != utils.KindJPEG {
+		return encoded.Bytes(), applied, nil
+	}
+
+	encodedSegments, scan, err := parseJPEG(encoded.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []jpegSegment
+	for i, segment := range segments {
+		if segment.marker < 0xE0 || segment.marker > 0xEF {
+			continue
+		}
+		switch {
+		case segment.marker == jpegMarkerAPP14:
+			continue
+		case segment.marker == jpegMarkerAPP2 && o.ColorMode != "":
+			continue
+		case i == exifIndex && o.ApplyOrientation:
+			if o.StripMetadata {
+				continue
+			}
+			segment = resetOrientation(segment, offset)
+		case i == exifIndex && o.StripMetadata && orientation > 1:
+			segment = orientationSegment(orientation)
+		case o.StripMetadata && segment.isMetadata():
+			continue
+		}
+		out = append(out, segment)
+	}
+	out = append(out, encodedSegments...)
+	if o.StripMetadata {
+		applied = append(applied, transformStripped)
+	}
+	return buildJPEG(out, scan), applied, nil
+}
+
+// applyOrientation はEXIFの向き（1〜8）に従って画像を回転・反転する
+func applyOrientation(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// 5〜8は縦横が入れ替わる
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 左右反転
+				sx, sy = w-1-x, y
+			case 3: // 180度回転
+				sx, sy = w-1-x, h-1-y
+			case 4: // 上下反転
+				sx, sy = x, h-1-y
+			case 5: // 転置
+				sx, sy = y, x
+			case 6: // 時計回りに90度回転
+				sx, sy = y, h-1-x
+			case 7: // 反転した転置
+				sx, sy = w-1-y, h-1-x
+			case 8: // 反時計回りに90度回転
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// count は変換の件数を数える
+func (s *TransformSink) count(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[name]++
+}
+
+// Close は変換の件数を出力し、出力を確定させる
+func (s *TransformSink) Close() error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.counts))
+	for name := range s.counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s %d件", name, s.counts[name]))
+	}
+	s.mu.Unlock()
+
+	if len(parts) > 0 {
+		log.Printf("コピー時の変換: %s", strings.Join(parts, ", "))
+	}
+	return s.Sink.Close()
+}
@@ -0,0 +1,166 @@
+package processor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// QuarantineFileName は検証で除外したファイルの一覧を出力するファイル名
+const QuarantineFileName = "quarantine.txt"
+
+// QuarantineDir は検証で除外したファイルをコピーするディレクトリ名
+const QuarantineDir = "quarantine"
+
+// decodableKinds は標準ライブラリでデコードできる形式
+var decodableKinds = map[string]bool{
+	utils.KindJPEG: true,
+	utils.KindPNG:  true,
+	utils.KindGIF:  true,
+}
+
+// QuarantinedFile は検証で除外したファイルとその理由
+type QuarantinedFile struct {
+	File   *dataset.File
+	Reason string
+}
+
+// VerifyImages は各サブクラスの画像をデコードして検証し、壊れたファイルを除外する
+// modeが config.VerifyHeader の場合はヘッダーのみ、config.VerifyFull の場合は画像全体をデコードする
+// 標準ライブラリでデコードできない形式（WebP, TIFF など）は検証せずに残す
+func VerifyImages(classes []*dataset.Class, mode string, maxWorkers int) []QuarantinedFile {
+	type job struct {
+		sub   *dataset.Subclass
+		index int
+	}
+
+	var jobs []job
+	unverifiable := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			for i, file := range sub.Files {
+				if !decodableKinds[utils.ExpectedKind(path.Ext(file.OutputName()))] {
+					unverifiable++
+					continue
+				}
+				jobs = append(jobs, job{sub: sub, index: i})
+			}
+		}
+	}
+
+	log.Printf("画像の検証を開始: %d件 (%s)", len(jobs), mode)
+	if unverifiable > 0 {
+		log.Printf("  検証できない形式のため未検証: %d件", unverifiable)
+	}
+
+	// 並列にデコードし、失敗理由を記録
+	reasons := make([]string, len(jobs))
+	sem := utils.NewSemaphore(max(maxWorkers, 1))
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, file *dataset.File) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			if err := verifyImage(file, mode); err != nil {
+				reasons[i] = err.Error()
+			}
+		}(i, j.sub.Files[j.index])
+	}
+	wg.Wait()
+
+	// 壊れたファイルをサブクラスから除外
+	var quarantined []QuarantinedFile
+	broken := make(map[*dataset.Subclass]map[int]bool)
+	for i, j := range jobs {
+		if reasons[i] == "" {
+			continue
+		}
+		file := j.sub.Files[j.index]
+		log.Printf("警告: 壊れた画像を除外します: %s: %s", file.Path, reasons[i])
+		quarantined = append(quarantined, QuarantinedFile{File: file, Reason: reasons[i]})
+		if broken[j.sub] == nil {
+			broken[j.sub] = make(map[int]bool)
+		}
+		broken[j.sub][j.index] = true
+	}
+	for sub, indexes := range broken {
+		files := make([]*dataset.File, 0, len(sub.Files)-len(indexes))
+		for i, file := range sub.Files {
+			if !indexes[i] {
+				files = append(files, file)
+			}
+		}
+		sub.Files = files
+		sub.AddSkipped(dataset.SkipCorrupt, len(indexes))
+	}
+
+	log.Printf("画像の検証が完了: 除外 %d件", len(quarantined))
+	return quarantined
+}
+
+// verifyImage は画像をデコードして検証
+func verifyImage(file *dataset.File, mode string) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if mode == config.VerifyFull {
+		_, _, err = image.Decode(r)
+	} else {
+		_, _, err = image.DecodeConfig(r)
+	}
+	switch err {
+	case nil:
+		return nil
+	case io.ErrUnexpectedEOF, io.EOF:
+		return fmt.Errorf("ファイルが途中で切れています")
+	case image.ErrFormat:
+		return fmt.Errorf("画像形式を認識できません")
+	default:
+		return fmt.Errorf("デコードに失敗: %v", err)
+	}
+}
+
+// WriteQuarantine は除外したファイルの一覧を出力し、copyFilesが真ならquarantine/にコピーする
+// 一覧は「クラス/サブクラス<TAB>ソース内のパス<TAB>理由」の形式とする
+func WriteQuarantine(sink Sink, quarantined []QuarantinedFile, copyFiles bool) error {
+	var report strings.Builder
+	for _, q := range quarantined {
+		fmt.Fprintf(&report, "%s/%s\t%s\t%s\n", q.File.Class, q.File.Subclass, q.File.Path, q.Reason)
+
+		if copyFiles {
+			destDir := path.Join(QuarantineDir, q.File.Class, q.File.Subclass)
+			if err := sink.MkdirAll(destDir); err != nil {
+				return fmt.Errorf("ディレクトリの作成に失敗: %v", err)
+			}
+			destPath := path.Join(destDir, q.File.OutputName())
+			if err := sink.CopyFile(q.File, destPath); err != nil {
+				log.Printf("警告: ファイルのコピーに失敗 %s -> %s: %v", q.File.Path, destPath, err)
+			}
+		}
+	}
+
+	if err := sink.WriteFile(QuarantineFileName, []byte(report.String())); err != nil {
+		return fmt.Errorf("%sの書き込みに失敗: %v", QuarantineFileName, err)
+	}
+	log.Printf("除外した画像の一覧を出力しました: %s (%d件)", QuarantineFileName, len(quarantined))
+	return nil
+}
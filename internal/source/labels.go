@@ -0,0 +1,187 @@
+package source
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"dataset-splitter/internal/dataset"
+)
+
+// labelRow はラベルファイルの1行
+type labelRow struct {
+	Path        string `json:"path"`
+	Label       string `json:"label"`
+	CoarseLabel string `json:"coarse_label"`
+	Group       string `json:"group"`
+}
+
+// utf8BOM はExcelなどが出力するCSV先頭のBOM
+const utf8BOM = "\ufeff"
+
+// labelColumns はCSVの列順（ヘッダー行がない場合）
+var labelColumns = []string{"path", "label", "coarse_label", "group"}
+
+// LoadLabelFile はラベルファイル（CSVまたはJSONL）からデータセットを作成
+// 各行の path はソース（fsys）内の相対パス、label はサブクラス、coarse_label は大まかなクラスとして扱う
+// coarse_label が空の場合は label をクラス名としても使用する
+func LoadLabelFile(labelPath string, fsys fs.FS) ([]*dataset.Class, error) {
+	file, err := os.Open(labelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows []labelRow
+	switch strings.ToLower(filepath.Ext(labelPath)) {
+	case ".jsonl", ".ndjson":
+		rows, err = readLabelJSONL(file)
+	default:
+		rows, err = readLabelCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ラベルファイルの読み込みに失敗: %v", err)
+	}
+
+	return buildClasses(rows, fsys), nil
+}
+
+// readLabelCSV はCSV形式のラベルファイルを読み込む
+// 1行目の先頭列が "path" の場合はヘッダー行として列名で対応付ける
+func readLabelCSV(r io.Reader) ([]labelRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := labelColumns
+	if len(records) > 0 && strings.EqualFold(strings.TrimPrefix(records[0][0], utf8BOM), "path") {
+		columns = make([]string, len(records[0]))
+		for i, name := range records[0] {
+			columns[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, utf8BOM)))
+		}
+		records = records[1:]
+	}
+
+	rows := make([]labelRow, 0, len(records))
+	for i, record := range records {
+		var row labelRow
+		for j, value := range record {
+			if j >= len(columns) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch columns[j] {
+			case "path":
+				row.Path = value
+			case "label":
+				row.Label = value
+			case "coarse_label":
+				row.CoarseLabel = value
+			case "group":
+				row.Group = value
+			}
+		}
+		if row.Path == "" || row.Label == "" {
+			return nil, fmt.Errorf("%d行目: path と label は必須です", i+1)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readLabelJSONL はJSONL形式のラベルファイルを読み込む
+func readLabelJSONL(r io.Reader) ([]labelRow, error) {
+	var rows []labelRow
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var row labelRow
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			return nil, fmt.Errorf("%d行目: %v", lineNo, err)
+		}
+		if row.Path == "" || row.Label == "" {
+			return nil, fmt.Errorf("%d行目: path と label は必須です", lineNo)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// buildClasses はラベルファイルの行からクラス/サブクラス構造を作成
+// クラス・サブクラスは名前順、サブクラス内のファイルはラベルファイルの記載順とする
+func buildClasses(rows []labelRow, fsys fs.FS) []*dataset.Class {
+	classMap := make(map[string]*dataset.Class)
+	subclassMap := make(map[string]map[string]*dataset.Subclass)
+	missing := 0
+
+	for _, row := range rows {
+		filePath := path.Clean(strings.TrimPrefix(filepath.ToSlash(row.Path), "/"))
+		if _, err := fs.Stat(fsys, filePath); err != nil {
+			missing++
+			log.Printf("警告: ラベルファイルに記載されたファイルが見つかりません: %s", row.Path)
+			continue
+		}
+
+		className := row.CoarseLabel
+		if className == "" {
+			className = row.Label
+		}
+
+		class, ok := classMap[className]
+		if !ok {
+			class = &dataset.Class{Name: className}
+			classMap[className] = class
+			subclassMap[className] = make(map[string]*dataset.Subclass)
+		}
+
+		sub, ok := subclassMap[className][row.Label]
+		if !ok {
+			sub = &dataset.Subclass{Name: row.Label}
+			subclassMap[className][row.Label] = sub
+			class.Subclasses = append(class.Subclasses, sub)
+		}
+
+		sub.Files = append(sub.Files, &dataset.File{
+			FS:       fsys,
+			Path:     filePath,
+			Class:    className,
+			Subclass: row.Label,
+			Group:    row.Group,
+		})
+	}
+
+	if missing > 0 {
+		log.Printf("警告: 見つからないファイル %d件をスキップしました", missing)
+	}
+
+	classes := make([]*dataset.Class, 0, len(classMap))
+	for _, class := range classMap {
+		sort.Slice(class.Subclasses, func(i, j int) bool {
+			return class.Subclasses[i].Name < class.Subclasses[j].Name
+		})
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	return classes
+}
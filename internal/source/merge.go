@@ -0,0 +1,115 @@
+package source
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
+)
+
+// MergeClasses は複数ソースのクラス構造を、クラス名・サブクラス名が同じもの同士で統合
+// rootsとrootNamesは同じ順序で指定する
+func MergeClasses(roots [][]*dataset.Class, rootNames []string, policy string) ([]*dataset.Class, error) {
+	classMap := make(map[string]*dataset.Class)
+	subclassMap := make(map[string]*dataset.Subclass)
+	seen := make(map[string]int) // クラス/サブクラス/ファイル名 -> ソース番号
+	counts := make(map[string][]int)
+	conflicts := 0
+
+	for rootIndex, classes := range roots {
+		for _, class := range classes {
+			merged, ok := classMap[class.Name]
+			if !ok {
+				merged = &dataset.Class{Name: class.Name}
+				classMap[class.Name] = merged
+			}
+
+			for _, sub := range class.Subclasses {
+				key := class.Name + "/" + sub.Name
+				mergedSub, ok := subclassMap[key]
+				if !ok {
+					mergedSub = &dataset.Subclass{Name: sub.Name}
+					subclassMap[key] = mergedSub
+					merged.Subclasses = append(merged.Subclasses, mergedSub)
+					counts[key] = make([]int, len(roots))
+				}
+				for reason, n := range sub.Skipped {
+					mergedSub.AddSkipped(reason, n)
+				}
+				mergedSub.Excluded = append(mergedSub.Excluded, sub.Excluded...)
+
+				for _, file := range sub.Files {
+					fileKey := key + "/" + file.OutputName()
+					first, exists := seen[fileKey]
+					if !exists {
+						seen[fileKey] = rootIndex
+						mergedSub.Files = append(mergedSub.Files, file)
+						counts[key][rootIndex]++
+						continue
+					}
+
+					conflicts++
+					switch policy {
+					case config.MergeError:
+						return nil, fmt.Errorf("ファイル名が衝突しました: %s（%s と %s）", fileKey, rootNames[first], rootNames[rootIndex])
+					case config.MergeRename:
+						file.Name = renameForRoot(file.OutputName(), rootIndex)
+						seen[key+"/"+file.Name] = rootIndex
+						mergedSub.Files = append(mergedSub.Files, file)
+						counts[key][rootIndex]++
+					default:
+						log.Printf("警告: ファイル名が衝突したためスキップ: %s（%s を優先）", fileKey, rootNames[first])
+					}
+				}
+			}
+		}
+	}
+
+	classes := make([]*dataset.Class, 0, len(classMap))
+	for _, class := range classMap {
+		sort.Slice(class.Subclasses, func(i, j int) bool {
+			return class.Subclasses[i].Name < class.Subclasses[j].Name
+		})
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+
+	logMergeReport(classes, rootNames, counts, conflicts)
+	return classes, nil
+}
+
+// renameForRoot はファイル名にソース番号を付ける（例: IMG_001.jpg -> IMG_001__src2.jpg）
+func renameForRoot(name string, rootIndex int) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s__src%d%s", strings.TrimSuffix(name, ext), rootIndex+1, ext)
+}
+
+// logMergeReport はソースごとのファイル数を出力
+func logMergeReport(classes []*dataset.Class, rootNames []string, counts map[string][]int, conflicts int) {
+	totals := make([]int, len(rootNames))
+
+	log.Printf("ソースごとのファイル数:")
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			key := class.Name + "/" + sub.Name
+			var parts []string
+			for i, count := range counts[key] {
+				totals[i] += count
+				parts = append(parts, fmt.Sprintf("src%d %d", i+1, count))
+			}
+			log.Printf("  %s: %s", key, strings.Join(parts, ", "))
+		}
+	}
+	for i, name := range rootNames {
+		log.Printf("  src%d (%s): 合計 %d件", i+1, name, totals[i])
+	}
+	if conflicts > 0 {
+		log.Printf("  ファイル名の衝突: %d件", conflicts)
+	}
+}
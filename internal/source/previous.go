@@ -0,0 +1,188 @@
+package source
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// previousMetadataFileName は以前の実行が分割ごとに出力するメタデータファイル名
+const previousMetadataFileName = "metadata.jsonl"
+
+// previousSplitNames は以前の出力から読み込む分割ディレクトリ名
+// quarantine など分割以外のディレクトリは読み込まない
+var previousSplitNames = map[string]bool{
+	"train":      true,
+	"validation": true,
+	"test":       true,
+}
+
+// previousRecord は以前の実行が出力したmetadata.jsonlの1行
+type previousRecord struct {
+	FileName string `json:"file_name"`
+	Subclass string `json:"subclass"`
+	Class    string `json:"class"`
+	Group    string `json:"group"`
+}
+
+// LoadPreviousOutput は以前の実行の出力（train, validation, test の分割ディレクトリ）からデータセットを作成
+// 分割ごとに metadata.jsonl があればクラス・サブクラス・グループを復元し、
+// ない場合は分割ディレクトリ直下のサブディレクトリをサブクラス（クラス名も同じ）として扱う
+// すべての分割のファイルを統合し、改めて分割の対象とする
+func LoadPreviousOutput(fsys fs.FS, opts utils.ScanOptions) ([]*dataset.Class, error) {
+	opts = opts.WithFilter(fsys)
+	dirs, err := utils.GetClassDirectories(fsys, ".", opts)
+	if err != nil {
+		return nil, err
+	}
+	var splitDirs []string
+	for _, dir := range dirs {
+		if !previousSplitNames[dir] {
+			log.Printf("分割ディレクトリではないためスキップ: %s", dir)
+			continue
+		}
+		splitDirs = append(splitDirs, dir)
+	}
+	if len(splitDirs) == 0 {
+		return nil, fmt.Errorf("分割ディレクトリ（train, validation, test）が見つかりません")
+	}
+
+	builder := newClassBuilder()
+	for _, splitDir := range splitDirs {
+		metadataPath := path.Join(splitDir, previousMetadataFileName)
+		if _, err := fs.Stat(fsys, metadataPath); err == nil {
+			count, err := loadPreviousMetadata(fsys, splitDir, metadataPath, builder)
+			if err != nil {
+				return nil, fmt.Errorf("%sの読み込みに失敗: %v", metadataPath, err)
+			}
+			log.Printf("前回の出力 '%s' を読み込みました: %s から %d件", splitDir, previousMetadataFileName, count)
+			continue
+		}
+
+		// metadata.jsonl がない場合はディレクトリ構造から読み込む
+		// 出力にはクラス名が残らないため、サブクラス名をクラス名としても使用する
+		count := 0
+		for _, sub := range scanClass(fsys, splitDir, opts).Subclasses {
+			target := builder.subclass(sub.Name, sub.Name)
+			for _, file := range sub.Files {
+				file.Class = sub.Name
+				target.Files = append(target.Files, file)
+			}
+			for reason, n := range sub.Skipped {
+				target.AddSkipped(reason, n)
+			}
+			target.Excluded = append(target.Excluded, sub.Excluded...)
+			count += len(sub.Files)
+		}
+		log.Printf("前回の出力 '%s' を読み込みました: ディレクトリ構造から %d件（サブクラス名をクラス名として使用）", splitDir, count)
+	}
+
+	return builder.classes(), nil
+}
+
+// loadPreviousMetadata は分割ディレクトリのmetadata.jsonlからファイルを読み込み、件数を返す
+func loadPreviousMetadata(fsys fs.FS, splitDir, metadataPath string, builder *classBuilder) (int, error) {
+	file, err := fsys.Open(metadataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count, missing := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record previousRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return 0, fmt.Errorf("%d行目: %v", lineNo, err)
+		}
+		if record.FileName == "" || record.Subclass == "" {
+			return 0, fmt.Errorf("%d行目: file_name と subclass は必須です", lineNo)
+		}
+		if record.Class == "" {
+			record.Class = record.Subclass
+		}
+
+		filePath := path.Join(splitDir, record.FileName)
+		if _, err := fs.Stat(fsys, filePath); err != nil {
+			missing++
+			log.Printf("警告: %sに記載されたファイルが見つかりません: %s", metadataPath, filePath)
+			continue
+		}
+
+		sub := builder.subclass(record.Class, record.Subclass)
+		sub.Files = append(sub.Files, &dataset.File{
+			FS:       fsys,
+			Path:     filePath,
+			Class:    record.Class,
+			Subclass: record.Subclass,
+			Group:    record.Group,
+		})
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	if missing > 0 {
+		log.Printf("警告: 見つからないファイル %d件をスキップしました", missing)
+	}
+	return count, nil
+}
+
+// classBuilder はクラス名・サブクラス名ごとにファイルを集めてクラス構造を作成
+type classBuilder struct {
+	classMap    map[string]*dataset.Class
+	subclassMap map[string]*dataset.Subclass
+}
+
+// newClassBuilder は空のclassBuilderを作成
+func newClassBuilder() *classBuilder {
+	return &classBuilder{
+		classMap:    make(map[string]*dataset.Class),
+		subclassMap: make(map[string]*dataset.Subclass),
+	}
+}
+
+// subclass はクラス・サブクラスを返す（未作成なら作成）
+func (b *classBuilder) subclass(className, subclassName string) *dataset.Subclass {
+	class, ok := b.classMap[className]
+	if !ok {
+		class = &dataset.Class{Name: className}
+		b.classMap[className] = class
+	}
+
+	key := className + "/" + subclassName
+	sub, ok := b.subclassMap[key]
+	if !ok {
+		sub = &dataset.Subclass{Name: subclassName}
+		b.subclassMap[key] = sub
+		class.Subclasses = append(class.Subclasses, sub)
+	}
+	return sub
+}
+
+// classes はクラス・サブクラスを名前順に整列して返す
+func (b *classBuilder) classes() []*dataset.Class {
+	classes := make([]*dataset.Class, 0, len(b.classMap))
+	for _, class := range b.classMap {
+		sort.Slice(class.Subclasses, func(i, j int) bool {
+			return class.Subclasses[i].Name < class.Subclasses[j].Name
+		})
+		classes = append(classes, class)
+	}
+	sort.Slice(classes, func(i, j int) bool {
+		return classes[i].Name < classes[j].Name
+	})
+	return classes
+}
@@ -0,0 +1,222 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"dataset-splitter/internal/storage"
+)
+
+// s3Entry はS3のオブジェクト一覧から作成したエントリ
+type s3Entry struct {
+	name    string // プレフィックスからの相対パス
+	key     string // オブジェクトキー（ディレクトリの場合は空）
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// info はエントリのFileInfoを返す
+func (e *s3Entry) info() fs.FileInfo {
+	if e.dir {
+		return implicitDirInfo(path.Base(e.name))
+	}
+	return s3FileInfo{entry: e}
+}
+
+// s3FS はS3互換オブジェクトストレージのプレフィックス以下をfs.FSとして扱う
+// 開く際にオブジェクト一覧を一度だけ取得して索引を作成するため、走査時にリクエストは発生しない
+type s3FS struct {
+	client   *storage.S3Client
+	bucket   string
+	entries  map[string]*s3Entry
+	children map[string][]*s3Entry
+}
+
+// OpenS3 はS3のプレフィックス（s3://bucket/prefix）をソースとして開く
+func OpenS3(client *storage.S3Client, p string) (*Source, error) {
+	bucket, prefix, err := storage.ParseS3URL(p)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	objects, err := client.ListObjects(bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("オブジェクト一覧の取得に失敗: %v", err)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("オブジェクトが見つかりません: %s", p)
+	}
+	log.Printf("S3から%d件のオブジェクトを取得しました: %s (%s)", len(objects), p, client.Endpoint())
+
+	s := &s3FS{client: client, bucket: bucket}
+	s.buildIndex(prefix, objects)
+	return &Source{Path: p, FS: s}, nil
+}
+
+// buildIndex はオブジェクト一覧からエントリ一覧を作成
+func (s *s3FS) buildIndex(prefix string, objects []storage.S3Object) {
+	s.entries = map[string]*s3Entry{".": {name: ".", dir: true}}
+
+	for _, object := range objects {
+		rel := strings.TrimPrefix(object.Key, prefix)
+
+		// "dir/" のようなフォルダを表す空オブジェクトはディレクトリとして扱う
+		isDir := strings.HasSuffix(rel, "/")
+		name := strings.TrimPrefix(path.Clean("/"+rel), "/")
+		if name == "" || !fs.ValidPath(name) {
+			continue
+		}
+
+		if isDir {
+			if _, ok := s.entries[name]; !ok {
+				s.entries[name] = &s3Entry{name: name, dir: true}
+			}
+		} else {
+			s.entries[name] = &s3Entry{name: name, key: object.Key, size: object.Size, modTime: object.LastModified}
+		}
+
+		// 親ディレクトリを補完
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, ok := s.entries[dir]; ok {
+				break
+			}
+			s.entries[dir] = &s3Entry{name: dir, dir: true}
+		}
+	}
+
+	// ディレクトリごとの子エントリ一覧を作成
+	s.children = make(map[string][]*s3Entry)
+	for name, entry := range s.entries {
+		if name == "." {
+			continue
+		}
+		parent := path.Dir(name)
+		s.children[parent] = append(s.children[parent], entry)
+	}
+	for _, children := range s.children {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+	}
+}
+
+// Open はエントリを開く（内容は最初の読み込み時に取得する）
+func (s *s3FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := s.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.dir {
+		return &s3Dir{entry: entry, children: s.children[name]}, nil
+	}
+	return &s3File{fsys: s, entry: entry}, nil
+}
+
+// ReadDir はディレクトリ内のエントリ一覧を返す
+func (s *s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, ok := s.entries[name]
+	if !ok || !entry.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return s3DirEntries(s.children[name]), nil
+}
+
+// Stat はエントリの情報を返す
+func (s *s3FS) Stat(name string) (fs.FileInfo, error) {
+	entry, ok := s.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return entry.info(), nil
+}
+
+// s3File はS3のオブジェクト
+type s3File struct {
+	fsys  *s3FS
+	entry *s3Entry
+	body  io.ReadCloser
+}
+
+func (f *s3File) Stat() (fs.FileInfo, error) { return f.entry.info(), nil }
+
+// Read は初回にオブジェクトを取得し、その内容を読み込む
+func (f *s3File) Read(b []byte) (int, error) {
+	if f.body == nil {
+		body, err := f.fsys.client.GetObject(f.fsys.bucket, f.entry.key)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: err}
+		}
+		f.body = body
+	}
+	return f.body.Read(b)
+}
+
+func (f *s3File) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+// s3Dir はS3のプレフィックス（ディレクトリ）
+type s3Dir struct {
+	entry    *s3Entry
+	children []*s3Entry
+	offset   int
+}
+
+func (d *s3Dir) Stat() (fs.FileInfo, error) { return d.entry.info(), nil }
+func (d *s3Dir) Close() error               { return nil }
+
+func (d *s3Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir はディレクトリ内のエントリを最大n件返す（n <= 0の場合は残りすべて）
+func (d *s3Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.children[d.offset:]
+	if n > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(rest) {
+			rest = rest[:n]
+		}
+	}
+	d.offset += len(rest)
+	return s3DirEntries(rest), nil
+}
+
+// s3DirEntries はエントリ一覧をDirEntryに変換
+func s3DirEntries(entries []*s3Entry) []fs.DirEntry {
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, fs.FileInfoToDirEntry(entry.info()))
+	}
+	return result
+}
+
+// s3FileInfo はオブジェクトのFileInfo
+type s3FileInfo struct {
+	entry *s3Entry
+}
+
+func (i s3FileInfo) Name() string       { return path.Base(i.entry.name) }
+func (i s3FileInfo) Size() int64        { return i.entry.size }
+func (i s3FileInfo) Mode() fs.FileMode  { return 0644 }
+func (i s3FileInfo) ModTime() time.Time { return i.entry.modTime }
+func (i s3FileInfo) IsDir() bool        { return false }
+func (i s3FileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,125 @@
+package source
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+// Source は読み込み元のデータセット
+type Source struct {
+	Path   string // 指定されたパス
+	FS     fs.FS  // クラス・サブクラスを探索するファイルシステム
+	closer io.Closer
+}
+
+// Open はディレクトリまたはアーカイブ（.tar, .tar.gz, .tgz, .zip）をソースとして開く
+// rootはアーカイブ内でソースのルートとして使うディレクトリ（空の場合は自動で判定、"." の場合はアーカイブ直下）
+func Open(p, root string) (*Source, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &Source{Path: p, FS: os.DirFS(p)}, nil
+	}
+
+	var fsys fs.FS
+	var closer io.Closer
+	lower := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, fmt.Errorf("zipファイルを開けません: %v", err)
+		}
+		fsys, closer = zr, zr
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		tfs, err := openTarGzFS(p)
+		if err != nil {
+			return nil, err
+		}
+		fsys, closer = tfs, tfs
+	case strings.HasSuffix(lower, ".tar"):
+		tfs, err := openTarFS(p)
+		if err != nil {
+			return nil, err
+		}
+		fsys, closer = tfs, tfs
+	default:
+		return nil, fmt.Errorf("未対応のソース形式です（ディレクトリ, .tar, .tar.gz, .zip に対応）: %s", p)
+	}
+
+	root, err = archiveRoot(fsys, root)
+	if err != nil {
+		closer.Close()
+		return nil, fmt.Errorf("アーカイブの読み込みに失敗: %v", err)
+	}
+	if root != "." {
+		log.Printf("アーカイブ内のディレクトリ '%s' をソースのルートとして使用します", root)
+		sub, err := fs.Sub(fsys, root)
+		if err != nil {
+			closer.Close()
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	return &Source{Path: p, FS: fsys, closer: closer}, nil
+}
+
+// archiveRoot はアーカイブ内でソースのルートとして使うディレクトリを返す
+// rootが空の場合、直下が単一のディレクトリのみで、その中にクラス/サブクラスの構造（孫ディレクトリ）がある場合は
+// そのディレクトリをルートとする（tar czf dataset.tar.gz dataset/ のように作成されたアーカイブ向け）
+// 単一のクラスのみを含むアーカイブ（A/A1/*, A/A2/*）は直下をルートとする
+func archiveRoot(fsys fs.FS, root string) (string, error) {
+	if root != "" {
+		root = path.Clean(strings.Trim(root, "/"))
+		if info, err := fs.Stat(fsys, root); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("ルートに指定したディレクトリ '%s' がありません", root)
+		}
+		return root, nil
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return ".", nil
+	}
+	top := entries[0].Name()
+	children, err := fs.ReadDir(fsys, top)
+	if err != nil {
+		return "", err
+	}
+	for _, child := range children {
+		if !child.IsDir() {
+			continue
+		}
+		grandchildren, err := fs.ReadDir(fsys, path.Join(top, child.Name()))
+		if err != nil {
+			return "", err
+		}
+		for _, grandchild := range grandchildren {
+			if grandchild.IsDir() {
+				return top, nil
+			}
+		}
+	}
+	return ".", nil
+}
+
+// Close はソースを閉じる
+func (s *Source) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
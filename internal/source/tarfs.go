@@ -0,0 +1,277 @@
+package source
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tarEntry はtarアーカイブ内のエントリ
+type tarEntry struct {
+	name   string      // 正規化したパス（スラッシュ区切り、先頭の "./" なし）
+	header *tar.Header // nilの場合はパスから補完したディレクトリ
+	offset int64       // データの開始位置
+}
+
+// info はエントリのFileInfoを返す
+func (e *tarEntry) info() fs.FileInfo {
+	if e.header == nil {
+		return implicitDirInfo(path.Base(e.name))
+	}
+	return e.header.FileInfo()
+}
+
+// isDir はエントリがディレクトリかどうかを返す
+func (e *tarEntry) isDir() bool {
+	return e.header == nil || e.header.Typeflag == tar.TypeDir
+}
+
+// tarFS はtar / tar.gzアーカイブをfs.FSとして扱う
+// エントリの位置を記録してランダムアクセスする
+// tar.gzはランダムアクセスできないため、開くときに一時ファイルへ一度だけ展開してから同じように扱う
+type tarFS struct {
+	file     *os.File
+	temp     bool // fileが閉じるときに削除する一時ファイルかどうか
+	entries  map[string]*tarEntry
+	children map[string][]*tarEntry
+}
+
+// openTarFS は非圧縮tarを開く
+func openTarFS(p string) (*tarFS, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newIndexedTarFS(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("tarファイルの読み込みに失敗: %v", err)
+	}
+	return t, nil
+}
+
+// openTarGzFS はgzip圧縮されたtarを一時ファイル（$TMPDIR）へ展開して開く
+func openTarGzFS(p string) (*tarFS, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("gzipファイルの読み込みに失敗: %v", err)
+	}
+	defer gr.Close()
+
+	temp, err := os.CreateTemp("", "dataset-splitter-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("一時ファイルの作成に失敗: %v", err)
+	}
+	log.Printf("tar.gzを一時ファイルに展開しています: %s -> %s", p, temp.Name())
+	removeTemp := func() {
+		temp.Close()
+		os.Remove(temp.Name())
+	}
+	if _, err := io.Copy(temp, gr); err != nil {
+		removeTemp()
+		return nil, fmt.Errorf("tar.gzファイルの展開に失敗: %v", err)
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		removeTemp()
+		return nil, err
+	}
+
+	t, err := newIndexedTarFS(temp)
+	if err != nil {
+		removeTemp()
+		return nil, fmt.Errorf("tar.gzファイルの読み込みに失敗: %v", err)
+	}
+	// 開いたまま削除できる環境（Unix）では先に削除し、異常終了時にも一時ファイルが残らないようにする
+	t.temp = os.Remove(temp.Name()) != nil
+	return t, nil
+}
+
+// newIndexedTarFS は先頭に位置するtarファイルのエントリ一覧と各データの位置を読み込む
+func newIndexedTarFS(file *os.File) (*tarFS, error) {
+	t := &tarFS{file: file}
+	err := t.buildIndex(tar.NewReader(file), func() (int64, error) {
+		return file.Seek(0, io.SeekCurrent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// buildIndex はアーカイブ全体を走査してエントリ一覧を作成
+func (t *tarFS) buildIndex(tr *tar.Reader, tell func() (int64, error)) error {
+	t.entries = map[string]*tarEntry{".": {name: "."}}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// 通常ファイルとディレクトリのみを対象とする
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir:
+		default:
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if name == "" {
+			continue
+		}
+
+		entry := &tarEntry{name: name, header: header}
+		if header.Typeflag == tar.TypeReg {
+			if entry.offset, err = tell(); err != nil {
+				return err
+			}
+		}
+		t.entries[name] = entry
+
+		// 親ディレクトリを補完
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if _, ok := t.entries[dir]; ok {
+				break
+			}
+			t.entries[dir] = &tarEntry{name: dir}
+		}
+	}
+
+	// ディレクトリごとの子エントリ一覧を作成
+	t.children = make(map[string][]*tarEntry)
+	for name, entry := range t.entries {
+		if name == "." {
+			continue
+		}
+		parent := path.Dir(name)
+		t.children[parent] = append(t.children[parent], entry)
+	}
+	for _, children := range t.children {
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].name < children[j].name
+		})
+	}
+	return nil
+}
+
+// Open はエントリを開く
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if entry.isDir() {
+		return &tarDir{entry: entry, children: t.children[name]}, nil
+	}
+
+	return &tarFile{entry: entry, r: io.NewSectionReader(t.file, entry.offset, entry.header.Size)}, nil
+}
+
+// ReadDir はディレクトリ内のエントリ一覧を返す
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, ok := t.entries[name]
+	if !ok || !entry.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return toDirEntries(t.children[name]), nil
+}
+
+// Stat はエントリの情報を返す
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return entry.info(), nil
+}
+
+// Close はアーカイブファイルを閉じる（展開した一時ファイルは削除する）
+func (t *tarFS) Close() error {
+	err := t.file.Close()
+	if t.temp {
+		if removeErr := os.Remove(t.file.Name()); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// tarFile はtar内の通常ファイル
+type tarFile struct {
+	entry *tarEntry
+	r     io.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry.info(), nil }
+func (f *tarFile) Read(b []byte) (int, error) { return f.r.Read(b) }
+func (f *tarFile) Close() error               { return nil }
+
+// tarDir はtar内のディレクトリ
+type tarDir struct {
+	entry    *tarEntry
+	children []*tarEntry
+	offset   int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.entry.info(), nil }
+func (d *tarDir) Close() error               { return nil }
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir はディレクトリ内のエントリを最大n件返す（n <= 0の場合は残りすべて）
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.children[d.offset:]
+	if n > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(rest) {
+			rest = rest[:n]
+		}
+	}
+	d.offset += len(rest)
+	return toDirEntries(rest), nil
+}
+
+// toDirEntries はエントリ一覧をDirEntryに変換
+func toDirEntries(entries []*tarEntry) []fs.DirEntry {
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, fs.FileInfoToDirEntry(entry.info()))
+	}
+	return result
+}
+
+// implicitDirInfo はアーカイブ内に明示されていないディレクトリのFileInfo
+type implicitDirInfo string
+
+func (d implicitDirInfo) Name() string       { return string(d) }
+func (d implicitDirInfo) Size() int64        { return 0 }
+func (d implicitDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (d implicitDirInfo) ModTime() time.Time { return time.Time{} }
+func (d implicitDirInfo) IsDir() bool        { return true }
+func (d implicitDirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,153 @@
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// ScanTree はクラス/サブクラスのディレクトリ構造を走査してデータセットを作成
+// クラス単位で最大maxConcurrent並列で走査する
+func ScanTree(fsys fs.FS, opts utils.ScanOptions, maxConcurrent int) ([]*dataset.Class, error) {
+	opts = opts.WithFilter(fsys)
+	classDirs, err := utils.GetClassDirectories(fsys, ".", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make([]*dataset.Class, len(classDirs))
+	sem := utils.NewSemaphore(max(maxConcurrent, 1))
+	var wg sync.WaitGroup
+
+	for i, classDir := range classDirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			sem.Acquire()
+			defer sem.Release()
+
+			classes[i] = scanClass(fsys, dir, opts)
+		}(i, classDir)
+	}
+	wg.Wait()
+
+	if opts.FollowSymlinks {
+		dedupLinkedFiles(fsys, classes)
+	}
+	return classes, nil
+}
+
+// dedupLinkedFiles は複数のサブクラスに同じ実体のファイル（シンボリックリンク・ハードリンク）がある場合に1つにまとめる
+// 並列に走査した結果によらず、クラス・サブクラス・パスの名前順で最初のものを残し、以降は重複として除外したファイルに記録する
+func dedupLinkedFiles(fsys fs.FS, classes []*dataset.Class) {
+	seen := utils.NewFileSet()
+	removed := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			kept := sub.Files[:0]
+			for _, file := range sub.Files {
+				info, err := fs.Stat(fsys, file.Path)
+				if err != nil {
+					kept = append(kept, file)
+					continue
+				}
+				if existing, ok := seen.Add(info, file.Path); ok {
+					sub.AddExcluded(file.Path, dataset.SkipDuplicate, "同じ実体: "+existing)
+					removed++
+					continue
+				}
+				kept = append(kept, file)
+			}
+			sub.Files = kept
+		}
+	}
+	if removed > 0 {
+		log.Printf("別のサブクラスと同じ実体を指すファイルを重複として除外しました: %d件", removed)
+	}
+}
+
+// scanClass はクラスディレクトリ内のサブクラスを走査
+func scanClass(fsys fs.FS, classDir string, opts utils.ScanOptions) *dataset.Class {
+	className := utils.GetClassName(classDir)
+	class := &dataset.Class{Name: className}
+
+	// サブディレクトリの取得
+	subDirs, err := utils.GetSubDirectories(fsys, classDir, opts)
+	if err != nil {
+		log.Printf("警告: クラス %s のサブディレクトリ取得に失敗: %v", className, err)
+		return class
+	}
+
+	for _, subDir := range subDirs {
+		subDirName := utils.GetClassName(subDir)
+
+		// 対象ファイルの取得
+		result, err := utils.ScanFiles(fsys, subDir, opts)
+		if err != nil {
+			log.Printf("警告: サブディレクトリ '%s/%s' のファイル一覧の取得に失敗: %v", className, subDirName, err)
+			continue
+		}
+
+		sub := &dataset.Subclass{
+			Name:  subDirName,
+			Files: dataset.NewFiles(fsys, result.Files, className, subDirName),
+		}
+		sub.AddSkipped(dataset.SkipJunkFile, result.JunkFiles)
+		sub.AddSkipped(dataset.SkipJunkDir, result.JunkDirs)
+		for _, sniffed := range result.NotMatching {
+			sub.AddExcluded(sniffed.Path, dataset.SkipNotMatch, "内容 "+sniffed.Kind)
+		}
+		if opts.DropMismatch {
+			for _, sniffed := range result.Mismatched {
+				sub.AddExcluded(sniffed.Path, dataset.SkipMismatch, fmt.Sprintf("拡張子 %s, 内容 %s", path.Ext(sniffed.Path), sniffed.Kind))
+			}
+		}
+		for _, duplicate := range result.Duplicates {
+			sub.AddExcluded(duplicate.Path, dataset.SkipDuplicate, "同じ実体: "+duplicate.Original)
+		}
+		for _, excluded := range result.SizeExcluded {
+			reason := dataset.SkipFileSize
+			if excluded.Size == 0 {
+				reason = dataset.SkipEmpty
+			}
+			sub.AddExcluded(excluded.Path, reason, fmt.Sprintf("%dバイト", excluded.Size))
+		}
+
+		renameDetected(sub, result.DetectedExts)
+		class.Subclasses = append(class.Subclasses, sub)
+	}
+
+	return class
+}
+
+// renameDetected は拡張子のないファイルに内容から判定した拡張子を付け、拡張子と内容の形式が異なるファイルの拡張子を変える
+// 変えた名前がサブクラス内の他のファイルと重なる場合は元の名前のまま出力する
+func renameDetected(sub *dataset.Subclass, detectedExts map[string]string) {
+	if len(detectedExts) == 0 {
+		return
+	}
+	used := make(map[string]bool, len(sub.Files))
+	for _, file := range sub.Files {
+		used[file.OutputName()] = true
+	}
+	for _, file := range sub.Files {
+		ext, ok := detectedExts[file.Path]
+		if !ok {
+			continue
+		}
+		base := path.Base(file.Path)
+		name := strings.TrimSuffix(base, path.Ext(base)) + ext
+		if used[name] {
+			log.Printf("警告: %s は同じサブクラスの %s と重なるため元の名前で出力します", base, name)
+			continue
+		}
+		used[name] = true
+		file.Name = name
+	}
+}
@@ -0,0 +1,226 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"dataset-splitter/internal/dataset"
+	"dataset-splitter/internal/utils"
+)
+
+// TestScanTreeLinkedFiles は別のサブクラスと同じ実体を指すファイルを名前順で最初のものだけ残し、
+// 残りを重複として除外したファイルに記録することを確認する
+func TestScanTreeLinkedFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("シンボリックリンクの作成に権限が必要")
+	}
+	tests := []struct {
+		name         string
+		links        map[string]string   // リンク -> ソースからの相対パスのリンク先
+		wantFiles    map[string][]string // クラス/サブクラス -> ファイル
+		wantExcluded map[string][]string // クラス/サブクラス -> 除外したファイル
+	}{
+		{
+			name:  "リンクなし",
+			links: map[string]string{},
+			wantFiles: map[string][]string{
+				"A/A1": {"A/A1/a.jpg"},
+				"B/B1": {"B/B1/b.jpg"},
+			},
+		},
+		{
+			name:  "別のクラスのファイルへのリンク",
+			links: map[string]string{"B/B1/link.jpg": "A/A1/a.jpg"},
+			wantFiles: map[string][]string{
+				"A/A1": {"A/A1/a.jpg"},
+				"B/B1": {"B/B1/b.jpg"},
+			},
+			wantExcluded: map[string][]string{"B/B1": {"B/B1/link.jpg"}},
+		},
+		{
+			name:  "名前順で先のサブクラスに残す",
+			links: map[string]string{"A/A1/link.jpg": "B/B1/b.jpg"},
+			wantFiles: map[string][]string{
+				"A/A1": {"A/A1/a.jpg", "A/A1/link.jpg"},
+				"B/B1": nil,
+			},
+			wantExcluded: map[string][]string{"B/B1": {"B/B1/b.jpg"}},
+		},
+		{
+			name:  "ソース外のマスターストアへのリンク",
+			links: map[string]string{"A/A2/m.jpg": "../store/m.jpg", "B/B1/m.jpg": "../store/m.jpg"},
+			wantFiles: map[string][]string{
+				"A/A1": {"A/A1/a.jpg"},
+				"A/A2": {"A/A2/m.jpg"},
+				"B/B1": {"B/B1/b.jpg"},
+			},
+			wantExcluded: map[string][]string{"B/B1": {"B/B1/m.jpg"}},
+		},
+		{
+			name:  "同じサブクラス内のリンク",
+			links: map[string]string{"A/A1/z.jpg": "A/A1/a.jpg"},
+			wantFiles: map[string][]string{
+				"A/A1": {"A/A1/a.jpg"},
+				"B/B1": {"B/B1/b.jpg"},
+			},
+			wantExcluded: map[string][]string{"A/A1": {"A/A1/z.jpg"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			root := filepath.Join(base, "src")
+			for _, name := range []string{"src/A/A1/a.jpg", "src/B/B1/b.jpg", "store/m.jpg"} {
+				p := filepath.Join(base, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for link, target := range tt.links {
+				p := filepath.Join(root, link)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				rel, err := filepath.Rel(filepath.Dir(p), filepath.Join(root, target))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(rel, p); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := utils.ScanOptions{Extensions: utils.ExtensionSet{".jpg": true}, FollowSymlinks: true}
+			classes, err := ScanTree(os.DirFS(root), opts, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotFiles := make(map[string][]string)
+			gotExcluded := make(map[string][]string)
+			for _, class := range classes {
+				for _, sub := range class.Subclasses {
+					key := class.Name + "/" + sub.Name
+					gotFiles[key] = nil
+					for _, file := range sub.Files {
+						gotFiles[key] = append(gotFiles[key], file.Path)
+					}
+					for _, excluded := range sub.Excluded {
+						if excluded.Reason != dataset.SkipDuplicate {
+							t.Errorf("%s: 除外の理由 = %q, want %q", excluded.Path, excluded.Reason, dataset.SkipDuplicate)
+						}
+						gotExcluded[key] = append(gotExcluded[key], excluded.Path)
+					}
+					if sub.Skipped[dataset.SkipDuplicate] != len(sub.Excluded) {
+						t.Errorf("%s: 重複の件数 = %d, want %d", key, sub.Skipped[dataset.SkipDuplicate], len(sub.Excluded))
+					}
+				}
+			}
+			for key, want := range tt.wantFiles {
+				if got := gotFiles[key]; !slices.Equal(got, want) {
+					t.Errorf("%s のファイル = %v, want %v", key, got, want)
+				}
+			}
+			for key := range gotFiles {
+				if !slices.Equal(gotExcluded[key], tt.wantExcluded[key]) {
+					t.Errorf("%s の除外 = %v, want %v", key, gotExcluded[key], tt.wantExcluded[key])
+				}
+			}
+		})
+	}
+}
+
+// TestScanTreeSniff は内容による形式の判定で除外したファイルが除外したファイルに記録され、
+// 拡張子と内容の形式が異なるファイルが設定に応じて扱われることを確認する
+func TestScanTreeSniff(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	png := []byte("\x89PNG\r\n\x1a\n")
+	fsys := fstest.MapFS{
+		"A/A1/ok.jpg":    {Data: jpeg},
+		"A/A1/png.jpg":   {Data: png},
+		"A/A1/error.jpg": {Data: []byte("<!DOCTYPE html><html></html>")},
+		"A/A1/IMG0001":   {Data: jpeg},
+		"A/A2/dup.jpg":   {Data: png},
+		"A/A2/dup.png":   {Data: png},
+	}
+	tests := []struct {
+		name         string
+		opts         utils.ScanOptions
+		wantNames    map[string][]string // クラス/サブクラス -> 出力するファイル名
+		wantExcluded []dataset.ExcludedFile
+	}{
+		{
+			name: "残す",
+			wantNames: map[string][]string{
+				"A/A1": {"IMG0001.jpg", "ok.jpg", "png.jpg"},
+				"A/A2": {"dup.jpg", "dup.png"},
+			},
+			wantExcluded: []dataset.ExcludedFile{
+				{Path: "A/A1/error.jpg", Reason: dataset.SkipNotMatch, Detail: "内容 html"},
+			},
+		},
+		{
+			name: "拡張子を変える",
+			opts: utils.ScanOptions{RenameMismatch: true},
+			wantNames: map[string][]string{
+				"A/A1": {"IMG0001.jpg", "ok.jpg", "png.png"},
+				"A/A2": {"dup.jpg", "dup.png"}, // 名前が重なるため元の名前
+			},
+			wantExcluded: []dataset.ExcludedFile{
+				{Path: "A/A1/error.jpg", Reason: dataset.SkipNotMatch, Detail: "内容 html"},
+			},
+		},
+		{
+			name: "除外する",
+			opts: utils.ScanOptions{DropMismatch: true},
+			wantNames: map[string][]string{
+				"A/A1": {"IMG0001.jpg", "ok.jpg"},
+				"A/A2": {"dup.png"},
+			},
+			wantExcluded: []dataset.ExcludedFile{
+				{Path: "A/A1/error.jpg", Reason: dataset.SkipNotMatch, Detail: "内容 html"},
+				{Path: "A/A1/png.jpg", Reason: dataset.SkipMismatch, Detail: "拡張子 .jpg, 内容 png"},
+				{Path: "A/A2/dup.jpg", Reason: dataset.SkipMismatch, Detail: "拡張子 .jpg, 内容 png"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Extensions = utils.ExtensionSet{".jpg": true, ".png": true}
+			opts.Sniff = true
+			classes, err := ScanTree(fsys, opts, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotExcluded []dataset.ExcludedFile
+			for _, class := range classes {
+				for _, sub := range class.Subclasses {
+					key := class.Name + "/" + sub.Name
+					var names []string
+					for _, file := range sub.Files {
+						names = append(names, file.OutputName())
+					}
+					slices.Sort(names)
+					if want := tt.wantNames[key]; !slices.Equal(names, want) {
+						t.Errorf("%s のファイル名 = %v, want %v", key, names, want)
+					}
+					gotExcluded = append(gotExcluded, sub.Excluded...)
+				}
+			}
+			slices.SortFunc(gotExcluded, func(a, b dataset.ExcludedFile) int { return strings.Compare(a.Path, b.Path) })
+			if !slices.Equal(gotExcluded, tt.wantExcluded) {
+				t.Errorf("除外したファイル = %v, want %v", gotExcluded, tt.wantExcluded)
+			}
+		})
+	}
+}
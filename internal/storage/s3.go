@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Scheme はS3互換オブジェクトストレージを指すURLのスキーム
+const S3Scheme = "s3://"
+
+// multipartPartSize はマルチパートアップロードの1パートのサイズ
+// これより大きいデータはマルチパートでアップロードする
+const multipartPartSize = 64 << 20
+
+// IsS3URL はパスがS3のURL（s3://bucket/prefix）かどうかを返す
+func IsS3URL(p string) bool {
+	return strings.HasPrefix(p, S3Scheme)
+}
+
+// ParseS3URL はS3のURLをバケット名とキー（プレフィックス）に分割
+func ParseS3URL(p string) (bucket, key string, err error) {
+	if !IsS3URL(p) {
+		return "", "", fmt.Errorf("S3のURLではありません: %s", p)
+	}
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(p, S3Scheme), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("バケット名が指定されていません: %s", p)
+	}
+	return bucket, key, nil
+}
+
+// S3Object はオブジェクト一覧の要素
+type S3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// S3Client はS3互換オブジェクトストレージ（AWS S3, MinIO など）のクライアント
+// 署名にはAWS Signature Version 4を使用し、パス形式（endpoint/bucket/key）でアクセスする
+type S3Client struct {
+	endpoint     *url.URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	httpClient   *http.Client
+	now          func() time.Time
+	partSize     int       // マルチパートアップロードの1パートのサイズ
+	partBuffers  sync.Pool // パート用のバッファ（*[]byte）
+}
+
+// NewS3Client はS3クライアントを作成
+// 認証情報は環境変数 AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN から読み込む
+// endpoint・regionが空の場合は AWS_ENDPOINT_URL, AWS_REGION (AWS_DEFAULT_REGION) を使用する
+func NewS3Client(endpoint, region string) (*S3Client, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("S3エンドポイントが不正です: %s", endpoint)
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("S3の認証情報が設定されていません（AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY）")
+	}
+
+	return &S3Client{
+		endpoint:     &url.URL{Scheme: u.Scheme, Host: u.Host},
+		region:       region,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		httpClient:   http.DefaultClient,
+		now:          time.Now,
+		partSize:     multipartPartSize,
+	}, nil
+}
+
+// Endpoint はエンドポイントのURLを返す
+func (c *S3Client) Endpoint() string {
+	return c.endpoint.String()
+}
+
+// ListObjects はプレフィックス以下のオブジェクトをすべて返す（ListObjectsV2）
+func (c *S3Client) ListObjects(bucket, prefix string) ([]S3Object, error) {
+	type listResult struct {
+		IsTruncated           bool
+		NextContinuationToken string
+		Contents              []struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+	}
+
+	var objects []S3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.do(http.MethodGet, bucket, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("オブジェクト一覧の解析に失敗: %v", err)
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, S3Object{Key: content.Key, Size: content.Size, LastModified: content.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// GetObject はオブジェクトの内容を読み込むReaderを返す（呼び出し側でCloseする）
+func (c *S3Client) GetObject(bucket, key string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, bucket, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// PutObject はデータをオブジェクトとして書き込む
+func (c *S3Client) PutObject(bucket, key string, data []byte) error {
+	resp, err := c.do(http.MethodPut, bucket, key, nil, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Upload はReaderの内容をオブジェクトとして書き込む
+// パートサイズに満たない場合は1回のPutObjectで書き込み、超える場合はマルチパートアップロードを使用する
+func (c *S3Client) Upload(bucket, key string, r io.Reader) error {
+	// 最初の1パート分までを読み込む（サイズが分かる場合はその分だけ確保する）
+	var first bytes.Buffer
+	if size, ok := readerSize(r); ok {
+		first.Grow(int(min(size, int64(c.partSize))) + bytes.MinRead)
+	}
+	if _, err := io.CopyN(&first, r, int64(c.partSize)); err != nil && err != io.EOF {
+		return err
+	}
+	if first.Len() < c.partSize {
+		return c.PutObject(bucket, key, first.Bytes())
+	}
+
+	uploadID, err := c.createMultipartUpload(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	type completedPart struct {
+		PartNumber int
+		ETag       string
+	}
+	var parts []completedPart
+	var buf []byte
+	part := first.Bytes()
+	for number := 1; len(part) > 0; number++ {
+		etag, err := c.uploadPart(bucket, key, uploadID, number, part)
+		if err != nil {
+			c.abortMultipartUpload(bucket, key, uploadID)
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+
+		// 2パート目以降はプールのバッファを使い回す
+		if buf == nil {
+			buf = c.getPartBuffer()
+			defer c.putPartBuffer(buf)
+		}
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			c.abortMultipartUpload(bucket, key, uploadID)
+			return err
+		}
+		part = buf[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		c.abortMultipartUpload(bucket, key, uploadID)
+		return err
+	}
+	resp, err := c.do(http.MethodPost, bucket, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		c.abortMultipartUpload(bucket, key, uploadID)
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// readerSize はReaderがファイルの場合にそのサイズを返す
+func readerSize(r io.Reader) (int64, bool) {
+	f, ok := r.(interface{ Stat() (fs.FileInfo, error) })
+	if !ok {
+		return 0, false
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// getPartBuffer はパート用のバッファをプールから取得（ない場合は作成）
+func (c *S3Client) getPartBuffer() []byte {
+	if buf, ok := c.partBuffers.Get().(*[]byte); ok && len(*buf) == c.partSize {
+		return *buf
+	}
+	return make([]byte, c.partSize)
+}
+
+// putPartBuffer はパート用のバッファをプールに戻す
+func (c *S3Client) putPartBuffer(buf []byte) {
+	c.partBuffers.Put(&buf)
+}
+
+// createMultipartUpload はマルチパートアップロードを開始し、アップロードIDを返す
+func (c *S3Client) createMultipartUpload(bucket, key string) (string, error) {
+	resp, err := c.do(http.MethodPost, bucket, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadId string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("マルチパートアップロードの開始に失敗: %v", err)
+	}
+	return result.UploadId, nil
+}
+
+// uploadPart はパートをアップロードし、ETagを返す
+func (c *S3Client) uploadPart(bucket, key, uploadID string, number int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	resp, err := c.do(http.MethodPut, bucket, key, query, nil, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// abortMultipartUpload はマルチパートアップロードを中止
+func (c *S3Client) abortMultipartUpload(bucket, key, uploadID string) {
+	resp, err := c.do(http.MethodDelete, bucket, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// s3Error はS3のエラーレスポンス
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do は署名付きリクエストを送信し、成功以外のステータスはエラーとして返す
+func (c *S3Client) do(method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := c.newRequest(method, bucket, key, query, header, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	target := bucket + "/" + key
+	var e s3Error
+	if err := xml.NewDecoder(resp.Body).Decode(&e); err != nil || e.Code == "" {
+		return nil, fmt.Errorf("S3リクエストに失敗 (%s %s): %s", method, target, resp.Status)
+	}
+	return nil, fmt.Errorf("S3リクエストに失敗 (%s %s): %s: %s: %s", method, target, resp.Status, e.Code, e.Message)
+}
+
+// newRequest は署名付きリクエストを作成
+func (c *S3Client) newRequest(method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Request, error) {
+	objectPath := "/" + bucket
+	if key != "" {
+		objectPath += "/" + key
+	}
+
+	u := *c.endpoint
+	u.Path = objectPath
+	u.RawPath = encodePath(objectPath)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+
+	sum := sha256.Sum256(body)
+	c.sign(req, hex.EncodeToString(sum[:]))
+	return req, nil
+}
+
+// sign はリクエストにAWS Signature Version 4の署名を付与
+// host, x-amz-*, range, content-type, content-md5 ヘッダーを署名対象とする
+func (c *S3Client) sign(req *http.Request, payloadHash string) {
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	// 署名対象ヘッダーを小文字・整列して連結
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" || lower == "content-type" || lower == "content-md5" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := dateStamp + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.secretKey), dateStamp)
+	signingKey = hmacSHA256(signingKey, c.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 はHMAC-SHA256を計算
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery はクエリを署名用の正規形（キー順、RFC 3986エンコード）に変換
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// encodePath はパスを署名用にエンコード（"/" はそのまま）
+func encodePath(p string) string {
+	return uriEncode(p, false)
+}
+
+// uriEncode はRFC 3986の非予約文字以外をパーセントエンコード
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
@@ -1,64 +1,293 @@
 package utils
 
 import (
-	"os"
-	"path/filepath"
+	"io/fs"
+	"log"
+	"path"
 	"strings"
 )
 
 // GetClassDirectories はルートディレクトリ内のクラスディレクトリを取得
-func GetClassDirectories(rootDir string) ([]string, error) {
-	var classDirs []string
-	entries, err := os.ReadDir(rootDir)
+func GetClassDirectories(fsys fs.FS, rootDir string, opts ScanOptions) ([]string, error) {
+	return getDirectories(fsys, rootDir, opts)
+}
+
+// GetSubDirectories は指定されたディレクトリ内のサブディレクトリを取得
+func GetSubDirectories(fsys fs.FS, rootDir string, opts ScanOptions) ([]string, error) {
+	return getDirectories(fsys, rootDir, opts)
+}
+
+// getDirectories はディレクトリ直下のディレクトリのうち、隠しディレクトリと除外対象を除いたものを取得
+// FollowSymlinksが有効な場合はディレクトリへのシンボリックリンクも対象とし、同じ実体を指すものは1つにまとめる
+func getDirectories(fsys fs.FS, rootDir string, opts ScanOptions) ([]string, error) {
+	var dirs []string
+	targets := NewFileSet()
+	entries, err := fs.ReadDir(fsys, rootDir)
 	if err != nil {
 		return nil, err
 	}
+	filter := opts.pathFilter(fsys)
 	for _, entry := range entries {
-		if entry.IsDir() {
-			if !strings.HasPrefix(entry.Name(), ".") {
-				classDirs = append(classDirs, filepath.Join(rootDir, entry.Name()))
+		dirPath := path.Join(rootDir, entry.Name())
+		isDir := entry.IsDir()
+
+		var target fs.FileInfo
+		if opts.FollowSymlinks && isSymlink(entry) {
+			if target, err = fs.Stat(fsys, dirPath); err == nil {
+				isDir = target.IsDir()
+			}
+		} else if opts.FollowSymlinks && isDir {
+			target, _ = entry.Info()
+		}
+
+		if isDir {
+			if !strings.HasPrefix(entry.Name(), ".") && !(opts.SkipJunk && IsJunkDir(entry.Name())) && !filter.excluded(dirPath, true) {
+				if target != nil {
+					if _, ok := targets.Add(target, dirPath); ok {
+						continue
+					}
+				}
+				dirs = append(dirs, dirPath)
 			}
 		}
 	}
-	return classDirs, nil
+	return dirs, nil
 }
 
-// GetSubDirectories は指定されたディレクトリ内のサブディレクトリを取得
-func GetSubDirectories(rootDir string) ([]string, error) {
-	var subDirs []string
-	entries, err := os.ReadDir(rootDir)
+// ScanOptions はファイル走査の設定
+type ScanOptions struct {
+	Extensions     ExtensionSet // 対象とする拡張子
+	Include        []string     // 対象とするファイルのglobパターン（空の場合はすべて）
+	Exclude        []string     // 除外するファイル・ディレクトリのglobパターン
+	FollowSymlinks bool         // シンボリックリンクをたどるかどうか
+	SkipJunk       bool         // 隠しファイル・OSやNASのメタデータを除外するかどうか
+	Sniff          bool         // ファイル先頭のバイト列で形式を判定するかどうか
+	RenameMismatch bool         // 拡張子と内容の形式が異なるファイルを内容の形式の拡張子で出力するかどうか（Sniff が有効な場合のみ）
+	DropMismatch   bool         // 拡張子と内容の形式が異なるファイルを除外するかどうか（Sniff が有効な場合のみ）
+	MinSize        int64        // 対象とするファイルサイズの下限（バイト、0: 制限なし）
+	MaxSize        int64        // 対象とするファイルサイズの上限（バイト、0: 制限なし）
+
+	filter *pathFilter // WithFilter で設定した、走査全体で共有するパスの絞り込み
+}
+
+// WithFilter はfsysの走査全体で共有するパスの絞り込みを設定した走査設定を返す
+// クラス・サブクラスごとの走査で .splitignore を読み直さないよう、1回の走査の開始時に呼び出す
+func (o ScanOptions) WithFilter(fsys fs.FS) ScanOptions {
+	o.filter = newPathFilter(fsys, o)
+	return o
+}
+
+// pathFilter は走査で使用するパスの絞り込みを返す（WithFilter で設定していない場合は新たに作成）
+func (o ScanOptions) pathFilter(fsys fs.FS) *pathFilter {
+	if o.filter != nil {
+		return o.filter
+	}
+	return newPathFilter(fsys, o)
+}
+
+// ScanResult はファイル走査の結果
+type ScanResult struct {
+	Files     []string // 対象ファイル
+	JunkFiles int      // 除外した隠しファイル・メタデータファイルの数
+	JunkDirs  int      // 除外した隠しディレクトリ・メタデータディレクトリの数
+
+	SizeExcluded []SizedFile     // ファイルサイズが範囲外のため除外したファイル
+	Duplicates   []DuplicateFile // 走査済みのファイルと同じ実体を指すため除外したファイル（FollowSymlinks が有効な場合のみ）
+
+	// 以下は Sniff が有効な場合のみ
+	NotMatching  []SniffedFile     // 内容が拡張子の形式でないため除外したファイル（HTMLのエラーページなど）
+	Mismatched   []SniffedFile     // 拡張子と異なる形式だが対象の形式のファイル（DropMismatch が有効な場合は除外）
+	DetectedExts map[string]string // 拡張子のないファイルと RenameMismatch で拡張子を変えるファイルについて、内容から判定した拡張子
+}
+
+// SniffedFile はファイルと内容から判定した形式
+type SniffedFile struct {
+	Path string
+	Kind string
+}
+
+// SizedFile はファイルとそのサイズ
+type SizedFile struct {
+	Path string
+	Size int64
+}
+
+// DuplicateFile は同じ実体のため除外したファイルと、残したファイル
+type DuplicateFile struct {
+	Path     string
+	Original string
+}
+
+// DefaultScanOptions は既定の走査設定（画像ファイルのみ、ジャンク除外あり）を返す
+func DefaultScanOptions() ScanOptions {
+	return ScanOptions{Extensions: DefaultExtensionSet(), SkipJunk: true}
+}
+
+// GetImageFiles は指定されたディレクトリ内の画像ファイルを再帰的に取得
+func GetImageFiles(fsys fs.FS, dir string) ([]string, error) {
+	return GetFiles(fsys, dir, DefaultScanOptions())
+}
+
+// GetFiles は指定されたディレクトリ内の対象ファイルを再帰的に取得
+func GetFiles(fsys fs.FS, dir string, opts ScanOptions) ([]string, error) {
+	result, err := ScanFiles(fsys, dir, opts)
 	if err != nil {
 		return nil, err
 	}
-	for _, entry := range entries {
-		if entry.IsDir() {
-			if !strings.HasPrefix(entry.Name(), ".") {
-				subDirs = append(subDirs, filepath.Join(rootDir, entry.Name()))
+	return result.Files, nil
+}
+
+// ScanFiles は指定されたディレクトリ内の対象ファイルを再帰的に取得し、除外した件数とともに返す
+func ScanFiles(fsys fs.FS, dir string, opts ScanOptions) (*ScanResult, error) {
+	result := &ScanResult{}
+	filter := opts.pathFilter(fsys)
+
+	// skip はエントリを除外するかどうかを判定し、ジャンクの件数を記録する
+	skip := func(p string, isDir bool) bool {
+		if p == dir {
+			return false
+		}
+		if opts.SkipJunk {
+			if isDir && IsJunkDir(path.Base(p)) {
+				result.JunkDirs++
+				return true
+			}
+			if !isDir && IsJunkFile(path.Base(p)) {
+				result.JunkFiles++
+				return true
 			}
 		}
+		return filter.excluded(p, isDir)
 	}
-	return subDirs, nil
-}
 
-// GetImageFiles は指定されたディレクトリ内の画像ファイルを再帰的に取得
-func GetImageFiles(dir string) ([]string, error) {
-	var files []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	// visit は対象ファイルを記録する
+	visit := func(p string) {
+		if !filter.included(p) {
+			return
+		}
+		if opts.Extensions.Contains(p) && !checkSize(fsys, p, opts, result) {
+			return
+		}
+		if opts.Sniff {
+			sniffAndRecord(fsys, p, opts, result)
+			return
+		}
+		if opts.Extensions.Contains(p) {
+			result.Files = append(result.Files, p)
+		}
+	}
+
+	if opts.FollowSymlinks {
+		duplicate := func(p, original string) {
+			if filter.included(p) && opts.Extensions.Contains(p) {
+				result.Duplicates = append(result.Duplicates, DuplicateFile{Path: p, Original: original})
+			}
+		}
+		err := walkFollowingSymlinks(fsys, dir, skip, visit, duplicate)
+		return result, err
+	}
+
+	err := fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(path))
-			if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".gif" || ext == ".bmp" {
-				files = append(files, path)
+		if skip(p, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
 			}
+			return nil
+		}
+		if !d.IsDir() {
+			visit(p)
 		}
 		return nil
 	})
-	return files, err
+	return result, err
+}
+
+// sniffAndRecord はファイルの内容から形式を判定し、対象であれば記録する
+// 拡張子と内容の形式が異なる場合は警告を出して設定に応じて残す・拡張子を変える・除外し、内容が対象の形式でなければ除外する
+// 拡張子のないファイルは内容が対象の形式であれば追加する
+func sniffAndRecord(fsys fs.FS, p string, opts ScanOptions, result *ScanResult) {
+	extensions := opts.Extensions
+	ext := path.Ext(p)
+	if ext != "" && !extensions.Contains(p) {
+		return
+	}
+
+	expected := ExpectedKind(ext)
+	if ext != "" && expected == "" {
+		// 形式を判定できない拡張子（テキストなど）は拡張子のみで判定
+		result.Files = append(result.Files, p)
+		return
+	}
+
+	kind, err := sniffFile(fsys, p)
+	if err != nil {
+		log.Printf("警告: ファイルの読み込みに失敗: %s: %v", p, err)
+		return
+	}
+
+	// 拡張子のないファイル
+	if ext == "" {
+		if detected := extensions.ExtensionForKind(kind); detected != "" && checkSize(fsys, p, opts, result) {
+			if result.DetectedExts == nil {
+				result.DetectedExts = make(map[string]string)
+			}
+			result.DetectedExts[p] = detected
+			result.Files = append(result.Files, p)
+		}
+		return
+	}
+
+	switch detected := extensions.ExtensionForKind(kind); {
+	case kind == expected:
+		result.Files = append(result.Files, p)
+	case detected != "":
+		result.Mismatched = append(result.Mismatched, SniffedFile{Path: p, Kind: kind})
+		switch {
+		case opts.DropMismatch:
+			log.Printf("警告: 拡張子と内容の形式が異なるため除外します: %s (拡張子 %s, 内容 %s)", p, ext, kind)
+			return
+		case opts.RenameMismatch:
+			log.Printf("警告: 拡張子と内容の形式が異なるため %s で出力します: %s (内容 %s)", detected, p, kind)
+			if result.DetectedExts == nil {
+				result.DetectedExts = make(map[string]string)
+			}
+			result.DetectedExts[p] = detected
+		default:
+			log.Printf("警告: 拡張子と内容の形式が異なります: %s (拡張子 %s, 内容 %s)", p, ext, kind)
+		}
+		result.Files = append(result.Files, p)
+	default:
+		if kind == "" {
+			kind = "不明"
+		}
+		log.Printf("警告: 内容が%sではないため除外します: %s (内容 %s)", expected, p, kind)
+		result.NotMatching = append(result.NotMatching, SniffedFile{Path: p, Kind: kind})
+	}
+}
+
+// checkSize はファイルサイズが範囲内かどうかを返し、範囲外であれば除外したファイルとして記録する
+// サイズを取得できない場合は対象とする（読み込み時に失敗として扱われる）
+func checkSize(fsys fs.FS, p string, opts ScanOptions, result *ScanResult) bool {
+	if opts.MinSize <= 0 && opts.MaxSize <= 0 {
+		return true
+	}
+	info, err := fs.Stat(fsys, p)
+	if err != nil {
+		log.Printf("警告: ファイルサイズの取得に失敗: %s: %v", p, err)
+		return true
+	}
+	size := info.Size()
+	if size < opts.MinSize || (opts.MaxSize > 0 && size > opts.MaxSize) {
+		result.SizeExcluded = append(result.SizeExcluded, SizedFile{Path: p, Size: size})
+		return false
+	}
+	return true
 }
 
 // GetClassName はディレクトリパスからクラス名を取得
 func GetClassName(dirPath string) string {
-	return filepath.Base(dirPath)
+	return path.Base(dirPath)
 }
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package utils
+
+import "io/fs"
+
+// fileIDSupported はファイルの識別子（デバイス番号とinode番号）を取得できるかどうか
+const fileIDSupported = false
+
+// getFileID はファイルの識別子を取得する（この環境では取得できないため常にfalse）
+func getFileID(info fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
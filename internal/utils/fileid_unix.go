@@ -0,0 +1,20 @@
+//go:build unix
+
+package utils
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileIDSupported はファイルの識別子（デバイス番号とinode番号）を取得できるかどうか
+const fileIDSupported = true
+
+// getFileID はファイル情報からデバイス番号とinode番号を取得する（取得できない場合はfalse）
+func getFileID(info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FileTypePresets はファイル種別ごとの既定の拡張子
+var FileTypePresets = map[string][]string{
+	"image": {".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tif", ".tiff", ".heic", ".heif"},
+	"audio": {".wav", ".flac", ".mp3", ".ogg", ".m4a", ".aac", ".opus"},
+	"text":  {".txt", ".md", ".json", ".jsonl", ".csv", ".tsv", ".xml"},
+}
+
+// DefaultFileType は既定のファイル種別
+const DefaultFileType = "image"
+
+// ExtensionSet は対象とする拡張子の集合（小文字・先頭ドット付き）
+type ExtensionSet map[string]bool
+
+// NewExtensionSet はファイル種別のプリセットと追加の拡張子から拡張子の集合を作成
+func NewExtensionSet(fileTypes, extensions []string) (ExtensionSet, error) {
+	set := make(ExtensionSet)
+	for _, fileType := range fileTypes {
+		preset, ok := FileTypePresets[strings.ToLower(fileType)]
+		if !ok {
+			return nil, fmt.Errorf("未対応のファイル種別: %s（%s のいずれかを指定してください）", fileType, strings.Join(FileTypeNames(), ", "))
+		}
+		for _, ext := range preset {
+			set[ext] = true
+		}
+	}
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		set[ext] = true
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("対象とする拡張子が指定されていません")
+	}
+	return set, nil
+}
+
+// DefaultExtensionSet は既定のファイル種別（画像）の拡張子の集合を返す
+func DefaultExtensionSet() ExtensionSet {
+	set, _ := NewExtensionSet([]string{DefaultFileType}, nil)
+	return set
+}
+
+// Contains はパスの拡張子が集合に含まれるかどうかを返す
+func (s ExtensionSet) Contains(p string) bool {
+	return s[strings.ToLower(path.Ext(p))]
+}
+
+// List は拡張子を整列して返す
+func (s ExtensionSet) List() []string {
+	exts := make([]string, 0, len(s))
+	for ext := range s {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// FileTypeNames はファイル種別のプリセット名を整列して返す
+func FileTypeNames() []string {
+	names := make([]string, 0, len(FileTypePresets))
+	for name := range FileTypePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
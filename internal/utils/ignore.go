@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// IgnoreFileName はソースツリー内に配置する除外設定ファイルの名前
+const IgnoreFileName = ".splitignore"
+
+// ignoreRule は除外パターン1件
+type ignoreRule struct {
+	pattern  string // 先頭・末尾のスラッシュを除いたパターン
+	negate   bool   // "!" で始まる場合は除外を取り消す
+	dirOnly  bool   // "/" で終わる場合はディレクトリのみに一致
+	anchored bool   // "/" を含む場合は基準ディレクトリからのパスに一致
+}
+
+// parseIgnoreRule はgitignore形式のパターンを解析
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// parseIgnoreRules は複数のパターンを解析
+func parseIgnoreRules(lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		if rule, ok := parseIgnoreRule(line); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matches はパターンが基準ディレクトリからの相対パスに一致するかどうかを返す
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return matchPattern(r.pattern, rel)
+	}
+	// スラッシュを含まないパターンは任意の階層の名前に一致
+	return matchPattern("**/"+r.pattern, rel)
+}
+
+// matchPattern はスラッシュ区切りのglobパターンとパスを照合（"**" は0個以上のディレクトリに一致）
+func matchPattern(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments はパス要素ごとにパターンを照合
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern, segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// pathFilter は include/exclude パターンと .splitignore によるパスの絞り込み
+// 1回の走査全体で共有し（ScanOptions.WithFilter）、読み込んだ .splitignore はディレクトリごとに保持する
+// 並列に走査するワーカーから同時に使用できる
+type pathFilter struct {
+	fsys    fs.FS
+	include []ignoreRule
+	exclude []ignoreRule
+
+	mu       sync.Mutex
+	dirRules map[string]*dirRules
+}
+
+// dirRules はディレクトリ直下の .splitignore のルール（読み込みは1回のみ）
+type dirRules struct {
+	once  sync.Once
+	rules []ignoreRule
+}
+
+// newPathFilter は走査設定からパスの絞り込みを作成
+func newPathFilter(fsys fs.FS, opts ScanOptions) *pathFilter {
+	return &pathFilter{
+		fsys:     fsys,
+		include:  parseIgnoreRules(opts.Include),
+		exclude:  parseIgnoreRules(opts.Exclude),
+		dirRules: make(map[string]*dirRules),
+	}
+}
+
+// rulesFor はディレクトリ直下の .splitignore のルールを返す
+func (f *pathFilter) rulesFor(dir string) []ignoreRule {
+	f.mu.Lock()
+	entry, ok := f.dirRules[dir]
+	if !ok {
+		entry = &dirRules{}
+		f.dirRules[dir] = entry
+	}
+	f.mu.Unlock()
+
+	entry.once.Do(func() {
+		data, err := fs.ReadFile(f.fsys, path.Join(dir, IgnoreFileName))
+		if err != nil {
+			return
+		}
+		var lines []string
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		entry.rules = parseIgnoreRules(lines)
+	})
+	return entry.rules
+}
+
+// excluded はパス（ソースルートからの相対パス）が除外対象かどうかを返す
+// コマンドラインの除外パターン、ルートから親ディレクトリまでの各 .splitignore の順に評価し、最後に一致したルールを採用する
+func (f *pathFilter) excluded(p string, isDir bool) bool {
+	if p == "." {
+		return false
+	}
+
+	excluded := false
+	for _, rule := range f.exclude {
+		if rule.matches(p, isDir) {
+			excluded = !rule.negate
+		}
+	}
+
+	// ルートから親ディレクトリまでの .splitignore を評価
+	dirs := []string{"."}
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/"))
+	}
+	for _, dir := range dirs {
+		rel := p
+		if dir != "." {
+			rel = strings.TrimPrefix(p, dir+"/")
+		}
+		for _, rule := range f.rulesFor(dir) {
+			if rule.matches(rel, isDir) {
+				excluded = !rule.negate
+			}
+		}
+	}
+	return excluded
+}
+
+// included はファイルが include パターンに一致するかどうかを返す（パターン未指定の場合は常に true）
+func (f *pathFilter) included(p string) bool {
+	if len(f.include) == 0 {
+		return true
+	}
+	included := false
+	for _, rule := range f.include {
+		if rule.matches(p, false) {
+			included = !rule.negate
+		}
+	}
+	return included
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// TestPathFilterExcluded はコマンドラインの除外パターンと .splitignore の評価を確認する
+func TestPathFilterExcluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		ignores map[string]string // ディレクトリ -> .splitignore の内容
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{name: "スラッシュなしは任意の階層に一致", exclude: []string{"*.tmp"}, path: "A/A1/x.tmp", want: true},
+		{name: "スラッシュなしは名前全体に一致", exclude: []string{"*.tmp"}, path: "A/A1/x.tmp.jpg", want: false},
+		{name: "スラッシュを含むと基準からのパスに一致", exclude: []string{"A/raw/*.jpg"}, path: "A/raw/x.jpg", want: true},
+		{name: "スラッシュを含むと途中の階層には一致しない", exclude: []string{"raw/*.jpg"}, path: "A/raw/x.jpg", want: false},
+		{name: "先頭のスラッシュで基準に固定", exclude: []string{"/A1"}, path: "A/A1", isDir: true, want: false},
+		{name: "先頭のスラッシュで基準直下に一致", exclude: []string{"/A"}, path: "A", isDir: true, want: true},
+		{name: "末尾のスラッシュはディレクトリに一致", exclude: []string{"cache/"}, path: "A/cache", isDir: true, want: true},
+		{name: "末尾のスラッシュはファイルに一致しない", exclude: []string{"cache/"}, path: "A/cache", want: false},
+		{name: "**は0個以上の階層に一致", exclude: []string{"A/**/x.jpg"}, path: "A/x.jpg", want: true},
+		{name: "**は複数の階層に一致", exclude: []string{"A/**/x.jpg"}, path: "A/A1/b/x.jpg", want: true},
+		{name: "否定で除外を取り消す", exclude: []string{"*.jpg", "!keep.jpg"}, path: "A/A1/keep.jpg", want: false},
+		{name: "否定に一致しなければ除外", exclude: []string{"*.jpg", "!keep.jpg"}, path: "A/A1/x.jpg", want: true},
+		{name: "後のルールが優先", exclude: []string{"!keep.jpg", "*.jpg"}, path: "A/A1/keep.jpg", want: true},
+		{
+			name:    ".splitignore はそのディレクトリからの相対パスで評価",
+			ignores: map[string]string{"A": "# コメント\n\nA1/\n"},
+			path:    "A/A1", isDir: true, want: true,
+		},
+		{
+			name:    ".splitignore は他のディレクトリに影響しない",
+			ignores: map[string]string{"A": "A1/\n"},
+			path:    "B/A1", isDir: true, want: false,
+		},
+		{
+			name:    "下の階層の .splitignore がコマンドラインの除外を取り消す",
+			exclude: []string{"*.png"},
+			ignores: map[string]string{"A/A1": "!keep.png\n"},
+			path:    "A/A1/keep.png", want: false,
+		},
+		{
+			name:    "下の階層の .splitignore が上の階層の否定を上書き",
+			ignores: map[string]string{".": "*.png\n!keep.png\n", "A": "keep.png\n"},
+			path:    "A/A1/keep.png", want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for dir, content := range tt.ignores {
+				fsys[path.Join(dir, IgnoreFileName)] = &fstest.MapFile{Data: []byte(content)}
+			}
+			filter := newPathFilter(fsys, ScanOptions{Exclude: tt.exclude})
+			if got := filter.excluded(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("excluded(%q, %t) = %t, want %t", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPathFilterIncluded は include パターンの評価を確認する
+func TestPathFilterIncluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		path    string
+		want    bool
+	}{
+		{name: "指定なしはすべて対象", path: "A/A1/x.jpg", want: true},
+		{name: "一致", include: []string{"*.jpg"}, path: "A/A1/x.jpg", want: true},
+		{name: "不一致", include: []string{"*.jpg"}, path: "A/A1/x.png", want: false},
+		{name: "否定", include: []string{"*.jpg", "!thumb_*"}, path: "A/A1/thumb_x.jpg", want: false},
+		{name: "固定したパス", include: []string{"A/A1/*.jpg"}, path: "B/A1/x.jpg", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := newPathFilter(fstest.MapFS{}, ScanOptions{Include: tt.include})
+			if got := filter.included(tt.path); got != tt.want {
+				t.Errorf("included(%q) = %t, want %t", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// countingFS は .splitignore を開いた回数を数えるfs.FS
+type countingFS struct {
+	fs.FS
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	if path.Base(name) == IgnoreFileName {
+		c.mu.Lock()
+		c.counts[name]++
+		c.mu.Unlock()
+	}
+	return c.FS.Open(name)
+}
+
+// TestWithFilterReadsIgnoreFilesOnce は走査全体で絞り込みを共有した場合、
+// 並列に走査しても各 .splitignore を1回だけ読み込むことを確認する
+func TestWithFilterReadsIgnoreFilesOnce(t *testing.T) {
+	mapFS := fstest.MapFS{
+		IgnoreFileName:                    {Data: []byte("*.tmp\n")},
+		"A/" + IgnoreFileName:             {Data: []byte("skip.jpg\n")},
+		"A/A1/" + IgnoreFileName:          {Data: []byte("!keep.tmp\n")},
+		"A/A1/x.jpg":                      {},
+		"A/A1/skip.jpg":                   {},
+		"A/A1/keep.tmp":                   {},
+		"A/A2/y.jpg":                      {},
+		"A/A2/z.tmp":                      {},
+		"B/B1/" + IgnoreFileName + ".bak": {},
+		"B/B1/w.jpg":                      {},
+	}
+	fsys := &countingFS{FS: mapFS, counts: make(map[string]int)}
+	opts := ScanOptions{Extensions: ExtensionSet{".jpg": true, ".tmp": true}}.WithFilter(fsys)
+
+	var wg sync.WaitGroup
+	results := make(map[string][]string)
+	var mu sync.Mutex
+	for _, classDir := range []string{"A", "B"} {
+		subDirs, err := GetSubDirectories(fsys, classDir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, subDir := range subDirs {
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(subDir string) {
+					defer wg.Done()
+					result, err := ScanFiles(fsys, subDir, opts)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					results[subDir] = result.Files
+					mu.Unlock()
+				}(subDir)
+			}
+		}
+	}
+	wg.Wait()
+
+	for name, count := range fsys.counts {
+		if count != 1 {
+			t.Errorf("%s を%d回読み込みました", name, count)
+		}
+	}
+	want := map[string][]string{
+		"A/A1": {"A/A1/keep.tmp", "A/A1/x.jpg"},
+		"A/A2": {"A/A2/y.jpg"},
+		"B/B1": {"B/B1/w.jpg"},
+	}
+	for dir, files := range want {
+		if got := results[dir]; !slices.Equal(got, files) {
+			t.Errorf("%s の対象ファイル = %v, want %v", dir, got, files)
+		}
+	}
+}
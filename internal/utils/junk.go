@@ -0,0 +1,47 @@
+package utils
+
+import "strings"
+
+// junkFileNames はOSやNASが作成するメタデータファイル名（小文字）
+var junkFileNames = map[string]bool{
+	".ds_store":   true, // macOS
+	"thumbs.db":   true, // Windows
+	"ehthumbs.db": true, // Windows
+	"desktop.ini": true, // Windows
+	"icon\r":      true, // macOS（カスタムアイコン）
+}
+
+// junkDirNames はOSやNASが作成するメタデータディレクトリ名（小文字）
+var junkDirNames = map[string]bool{
+	"__macosx":                  true, // macOSのzip展開時
+	".appledouble":              true, // macOS
+	".thumbnails":               true, // Linuxデスクトップ
+	".trashes":                  true, // macOS
+	".spotlight-v100":           true, // macOS
+	".fseventsd":                true, // macOS
+	".temporaryitems":           true, // macOS
+	"$recycle.bin":              true, // Windows
+	"system volume information": true, // Windows
+	"@eadir":                    true, // Synology
+	"#recycle":                  true, // Synology
+	".@__thumb":                 true, // QNAP
+	"@recently-snapshot":        true, // QNAP
+	".snapshot":                 true, // NetApp など
+}
+
+// IsJunkFile は隠しファイル・OSのメタデータファイルかどうかを返す
+// macOSのAppleDoubleファイル（._IMG_001.jpg）やOfficeの一時ファイル（~$）も対象とする
+func IsJunkFile(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$") {
+		return true
+	}
+	return junkFileNames[strings.ToLower(name)]
+}
+
+// IsJunkDir は隠しディレクトリ・OSやNASのメタデータディレクトリかどうかを返す
+func IsJunkDir(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	return junkDirNames[strings.ToLower(name)]
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// sniffLength は形式の判定に読み込む先頭のバイト数
+const sniffLength = 64
+
+// 内容から判定したファイル形式
+const (
+	KindJPEG  = "jpeg"
+	KindPNG   = "png"
+	KindGIF   = "gif"
+	KindBMP   = "bmp"
+	KindWebP  = "webp"
+	KindTIFF  = "tiff"
+	KindHEIF  = "heif"
+	KindAVIF  = "avif"
+	KindWAV   = "wav"
+	KindFLAC  = "flac"
+	KindOgg   = "ogg"
+	KindMPEG  = "mpeg-audio"
+	KindMP4   = "mp4"
+	KindHTML  = "html"
+	KindPDF   = "pdf"
+	KindEmpty = "empty"
+)
+
+// extensionKinds は拡張子と期待する内容の形式の対応（対応がない拡張子は判定しない）
+var extensionKinds = map[string]string{
+	".jpg":  KindJPEG,
+	".jpeg": KindJPEG,
+	".png":  KindPNG,
+	".gif":  KindGIF,
+	".bmp":  KindBMP,
+	".webp": KindWebP,
+	".tif":  KindTIFF,
+	".tiff": KindTIFF,
+	".heic": KindHEIF,
+	".heif": KindHEIF,
+	".avif": KindAVIF,
+	".wav":  KindWAV,
+	".flac": KindFLAC,
+	".ogg":  KindOgg,
+	".opus": KindOgg,
+	".mp3":  KindMPEG,
+	".aac":  KindMPEG,
+	".m4a":  KindMP4,
+}
+
+// heifBrands はHEIF形式を示すftypブランド
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+// SniffKind はファイル先頭のバイト列から形式を判定（判定できない場合は空文字）
+func SniffKind(data []byte) string {
+	switch {
+	case len(data) == 0:
+		return KindEmpty
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return KindJPEG
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return KindPNG
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return KindGIF
+	case bytes.HasPrefix(data, []byte("BM")) && len(data) >= 14:
+		return KindBMP
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		return KindWebP
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WAVE":
+		return KindWAV
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return KindTIFF
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		brand := string(data[8:12])
+		switch {
+		case heifBrands[brand]:
+			return KindHEIF
+		case brand == "avif" || brand == "avis":
+			return KindAVIF
+		default:
+			return KindMP4
+		}
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return KindFLAC
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return KindOgg
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return KindMPEG
+	case bytes.HasPrefix(data, []byte("%PDF")):
+		return KindPDF
+	}
+
+	// HTMLのエラーページなど（先頭の空白・BOMを除いて "<" で始まる）
+	text := strings.TrimLeft(string(data), " \t\r\n\ufeff")
+	if strings.HasPrefix(text, "<") {
+		return KindHTML
+	}
+	return ""
+}
+
+// ExpectedKind は拡張子から期待する内容の形式を返す（判定対象外の拡張子は空文字）
+func ExpectedKind(ext string) string {
+	return extensionKinds[strings.ToLower(ext)]
+}
+
+// ExtensionForKind は形式に対応する拡張子のうち、集合に含まれるものを返す（ない場合は空文字）
+// 複数ある場合は短いもの（.jpeg より .jpg）を優先
+func (s ExtensionSet) ExtensionForKind(kind string) string {
+	found := ""
+	for _, ext := range s.List() {
+		if extensionKinds[ext] == kind && (found == "" || len(ext) < len(found)) {
+			found = ext
+		}
+	}
+	return found
+}
+
+// sniffFile はファイルの先頭を読み込んで形式を判定
+func sniffFile(fsys fs.FS, p string) (string, error) {
+	file, err := fsys.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return SniffKind(buf[:n]), nil
+}
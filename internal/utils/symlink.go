@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path"
+)
+
+// isSymlink はディレクトリエントリがシンボリックリンクかどうかを返す
+func isSymlink(entry fs.DirEntry) bool {
+	return entry.Type()&fs.ModeSymlink != 0
+}
+
+// containsSameFile はinfosにtargetと同一のファイル・ディレクトリが含まれるかどうかを返す
+func containsSameFile(infos []fs.FileInfo, target fs.FileInfo) bool {
+	for _, info := range infos {
+		if os.SameFile(info, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileID はファイルの実体の識別子
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// sameFile はファイル情報とその名前（FileSet に追加したときの名前）
+type sameFile struct {
+	info fs.FileInfo
+	name string
+}
+
+// FileSet は走査済みのファイル・ディレクトリの実体の集合
+// 識別子を取得できない環境では os.SameFile で線形に比較する
+type FileSet struct {
+	ids    map[fileID]string
+	others []sameFile
+}
+
+// NewFileSet は空の集合を作成
+func NewFileSet() *FileSet {
+	return &FileSet{ids: make(map[fileID]string)}
+}
+
+// Add は実体を名前とともに追加し、既に含まれていた場合は先に追加した名前とtrueを返す
+// 識別子を取得できる環境でファイル情報に識別子がない場合（アーカイブ内のエントリなど）は実体を比較できないため追加しない
+func (s *FileSet) Add(info fs.FileInfo, name string) (string, bool) {
+	if id, ok := getFileID(info); ok {
+		if existing, ok := s.ids[id]; ok {
+			return existing, true
+		}
+		s.ids[id] = name
+		return "", false
+	}
+	if fileIDSupported {
+		return "", false
+	}
+	for _, other := range s.others {
+		if os.SameFile(other.info, info) {
+			return other.name, true
+		}
+	}
+	s.others = append(s.others, sameFile{info: info, name: name})
+	return "", false
+}
+
+// symlinkWalker はシンボリックリンクをたどってディレクトリを再帰的に走査する
+// 祖先ディレクトリへのリンク（循環）はスキップし、同じ実体を指すディレクトリ・ファイルは一度だけ走査する
+// 別のサブクラスと同じ実体を指すファイルは走査後にまとめて判定する（source.ScanTree）
+type symlinkWalker struct {
+	fsys         fs.FS
+	skip         func(p string, isDir bool) bool
+	duplicate    func(p, original string)
+	visitedDirs  *FileSet
+	visitedFiles *FileSet // 走査したファイルの実体（リンク経由・直接の両方）
+}
+
+// walkFollowingSymlinks はdir以下のファイルをシンボリックリンクをたどって走査し、visitを呼び出す
+// skipが true を返したエントリは除外し、走査済みのファイルと同じ実体を指すファイルは先に走査したファイルとともにduplicateを呼び出す
+func walkFollowingSymlinks(fsys fs.FS, dir string, skip func(p string, isDir bool) bool, visit func(p string), duplicate func(p, original string)) error {
+	rootInfo, err := fs.Stat(fsys, dir)
+	if err != nil {
+		return err
+	}
+	w := &symlinkWalker{fsys: fsys, skip: skip, duplicate: duplicate, visitedDirs: NewFileSet(), visitedFiles: NewFileSet()}
+	w.visitedDirs.Add(rootInfo, dir)
+	return w.walk(dir, []fs.FileInfo{rootInfo}, visit)
+}
+
+// walk はディレクトリ内のエントリを走査
+func (w *symlinkWalker) walk(dir string, ancestors []fs.FileInfo, visit func(p string)) error {
+	entries, err := fs.ReadDir(w.fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		p := path.Join(dir, entry.Name())
+		isDir := entry.IsDir()
+
+		// シンボリックリンクはリンク先の情報で判定
+		var target fs.FileInfo
+		if isSymlink(entry) {
+			target, err = fs.Stat(w.fsys, p)
+			if err != nil {
+				log.Printf("警告: リンク切れのシンボリックリンクをスキップ: %s", p)
+				continue
+			}
+			isDir = target.IsDir()
+		}
+
+		if w.skip(p, isDir) {
+			continue
+		}
+
+		if target == nil {
+			if target, err = entry.Info(); err != nil {
+				return err
+			}
+		}
+
+		if isDir {
+			if containsSameFile(ancestors, target) {
+				log.Printf("警告: 循環するシンボリックリンクをスキップ: %s", p)
+				continue
+			}
+			if _, ok := w.visitedDirs.Add(target, p); ok {
+				log.Printf("    同じディレクトリを指すリンクのため重複をスキップ: %s", p)
+				continue
+			}
+
+			if err := w.walk(p, append(ancestors[:len(ancestors):len(ancestors)], target), visit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if existing, ok := w.visitedFiles.Add(target, p); ok {
+			log.Printf("    %s と同じファイルを指すため重複をスキップ: %s", existing, p)
+			w.duplicate(p, existing)
+			continue
+		}
+		visit(p)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+//go:build unix
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestScanFilesFollowingSymlinks はシンボリックリンクをたどった走査で、循環・同じ実体・リンク切れを扱えることを確認する
+func TestScanFilesFollowingSymlinks(t *testing.T) {
+	tests := []struct {
+		name           string
+		files          []string          // 作成する通常のファイル
+		links          map[string]string // リンク -> リンク先
+		wantFiles      []string
+		wantDuplicates []DuplicateFile
+	}{
+		{
+			name:      "リンクなし",
+			files:     []string{"A1/a.jpg", "A1/sub/b.jpg"},
+			wantFiles: []string{"A1/a.jpg", "A1/sub/b.jpg"},
+		},
+		{
+			name:      "祖先ディレクトリへのリンクはスキップ",
+			files:     []string{"A1/a.jpg"},
+			links:     map[string]string{"A1/loop": "..", "A1/self": "."},
+			wantFiles: []string{"A1/a.jpg"},
+		},
+		{
+			name:      "同じディレクトリを指すリンクは一度だけ走査",
+			files:     []string{"store/a.jpg"},
+			links:     map[string]string{"A1/x": "../store", "A1/y": "../store"},
+			wantFiles: []string{"A1/x/a.jpg"},
+		},
+		{
+			name:           "同じファイルを指すリンクは重複",
+			files:          []string{"A1/j0.jpg"},
+			links:          map[string]string{"A1/link0.jpg": "j0.jpg"},
+			wantFiles:      []string{"A1/j0.jpg"},
+			wantDuplicates: []DuplicateFile{{Path: "A1/link0.jpg", Original: "A1/j0.jpg"}},
+		},
+		{
+			name:           "外部のファイルへの複数のリンク",
+			files:          []string{"store/a.jpg"},
+			links:          map[string]string{"A1/p.jpg": "../store/a.jpg", "A1/q.jpg": "../store/a.jpg"},
+			wantFiles:      []string{"A1/p.jpg"},
+			wantDuplicates: []DuplicateFile{{Path: "A1/q.jpg", Original: "A1/p.jpg"}},
+		},
+		{
+			name:      "リンク切れはスキップ",
+			files:     []string{"A1/a.jpg"},
+			links:     map[string]string{"A1/broken.jpg": "missing.jpg", "A1/gone": "../missing"},
+			wantFiles: []string{"A1/a.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, name := range tt.files {
+				p := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for link, target := range tt.links {
+				p := filepath.Join(root, link)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(target, p); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := ScanOptions{Extensions: ExtensionSet{".jpg": true}, FollowSymlinks: true}
+			result, err := ScanFiles(os.DirFS(root), "A1", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(result.Files, tt.wantFiles) {
+				t.Errorf("Files = %v, want %v", result.Files, tt.wantFiles)
+			}
+			if !slices.Equal(result.Duplicates, tt.wantDuplicates) {
+				t.Errorf("Duplicates = %v, want %v", result.Duplicates, tt.wantDuplicates)
+			}
+		})
+	}
+}
+
+// TestFileSetAdd は同じ実体を指すパスを判定できることを確認する
+func TestFileSetAdd(t *testing.T) {
+	root := t.TempDir()
+	orig := filepath.Join(root, "a.jpg")
+	if err := os.WriteFile(orig, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "b.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.jpg", filepath.Join(root, "sym.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(orig, filepath.Join(root, "hard.jpg")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		wantDup  bool
+		wantOrig string
+	}{
+		{name: "a.jpg"},
+		{name: "b.jpg"}, // 内容が同じでも別の実体
+		{name: "sym.jpg", wantDup: true, wantOrig: "a.jpg"},
+		{name: "hard.jpg", wantDup: true, wantOrig: "a.jpg"},
+	}
+	set := NewFileSet()
+	for _, tt := range tests {
+		info, err := os.Stat(filepath.Join(root, tt.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig, dup := set.Add(info, tt.name)
+		if dup != tt.wantDup || orig != tt.wantOrig {
+			t.Errorf("Add(%s) = (%q, %t), want (%q, %t)", tt.name, orig, dup, tt.wantOrig, tt.wantDup)
+		}
+	}
+}
@@ -4,13 +4,25 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"sync"
 
 	"dataset-splitter/internal/config"
+	"dataset-splitter/internal/dataset"
 	"dataset-splitter/internal/processor"
+	"dataset-splitter/internal/source"
+	"dataset-splitter/internal/storage"
 	"dataset-splitter/internal/utils"
 )
 
 func main() {
+	// サブコマンド
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		runStats(os.Args[2:])
+		return
+	}
+
 	// フラグの解析
 	config := parseFlags()
 
@@ -21,58 +33,262 @@ func main() {
 
 	// ログ出力
 	log.Printf("データセット分割を開始します...")
-	log.Printf("ソース: %s", config.SourceDir)
+	log.Printf("ソース: %s", strings.Join(config.SourceDirs, ", "))
 	log.Printf("出力先: %s", config.DestDir)
 	log.Printf("教師データ比率: %.2f%%", config.TrainingRatio*100)
 	log.Printf("検証データ比率: %.2f%%", config.GetValidationRatio()*100)
 	log.Printf("最小ファイル数: %d", config.MinFileCount)
-	log.Printf("tar出力: %t", config.TarOutput)
+	if format := config.GetArchiveFormat(); format != "" {
+		log.Printf("アーカイブ出力: %s (圧縮レベル %d, 直接出力 %t, 分割ごと %t, 再現可能 %t)", format, config.CompressionLevel, config.ArchiveDirect, config.ArchivePerSplit, config.ReproducibleArchive)
+		log.Printf("アーカイブ出力先: %s", config.GetArchivePath(""))
+	}
 	log.Printf("並列処理: %dクラス, %dワーカー", config.MaxConcurrent, config.MaxCopyWorkers)
 
+	if config.Resplit {
+		log.Printf("再分割モード: ソースを以前の実行の出力として読み込みます")
+	}
+
 	if config.BinaryMode {
 		log.Printf("二値分類モード: positiveクラス '%s'", config.PositiveClass)
 	}
 
-	// クラスディレクトリの取得
-	classDirs, err := utils.GetClassDirectories(config.SourceDir)
+	// S3クライアントの作成（S3を使用する場合のみ）
+	s3, err := newS3Client(config)
+	if err != nil {
+		log.Fatalf("S3クライアントの作成に失敗: %v", err)
+	}
+
+	// ソースを開く（ディレクトリ、アーカイブまたはS3）
+	sources, err := openSources(config, s3)
+	if err != nil {
+		log.Fatalf("ソースを開けません: %v", err)
+	}
+	defer closeSources(sources)
+
+	// クラス・サブクラスの取得
+	classes, err := loadClasses(config, sources)
+	if err != nil {
+		log.Fatalf("クラスの取得に失敗: %v", err)
+	}
+
+	log.Printf("検出されたクラス数: %d", len(classes))
+
+	// ラベルの矛盾の検出（同じ内容のファイルが複数のラベルに属するアノテーションの誤り）
+	var conflicts []processor.LabelConflict
+	if config.LabelConflicts != "" {
+		conflicts, err = processor.ResolveLabelConflicts(classes, config.LabelConflicts, config.MaxCopyWorkers)
+		if err != nil {
+			log.Fatalf("ラベルの矛盾の検出: %v", err)
+		}
+	}
+
+	// 重複ファイルの検出（同じ内容のファイルが教師データと検証データに分かれるのを防ぐ）
+	var duplicates []processor.DuplicateGroup
+	if config.Dedup != "" {
+		duplicates, err = processor.RemoveDuplicates(classes, config.Dedup, config.MaxCopyWorkers)
+		if err != nil {
+			log.Fatalf("重複ファイルの検出: %v", err)
+		}
+	}
+
+	// 画像の検証（壊れたファイルは分割の対象から除外）
+	var quarantined []processor.QuarantinedFile
+	if config.VerifyImages != "" {
+		quarantined = processor.VerifyImages(classes, config.VerifyImages, config.MaxCopyWorkers)
+	}
+
+	// 解像度・縦横比による除外（最小ファイル数の確認・分割の前に行う）
+	if limits := processor.NewDimensionLimits(config); limits.Enabled() {
+		processor.FilterByDimensions(classes, limits, config.MaxCopyWorkers)
+	}
+
+	// 色モードの検査（グレースケール・CMYK・パレット・透過・16ビットの画像の検出）
+	var colorModeFiles []*dataset.File
+	if config.ColorCheck != "" {
+		colorModeFiles = processor.CheckColorModes(classes, config.ColorCheck, config.MaxCopyWorkers)
+	}
+
+	// 再エンコードで拡張子が変わるファイルの出力ファイル名の変更
+	transform := processor.NewTransformOptions(config)
+	processor.RenameForEncoding(classes, transform)
+
+	// 出力先の作成
+	sink, err := newSink(config, s3)
 	if err != nil {
-		log.Fatalf("クラスディレクトリの取得に失敗: %v", err)
+		log.Fatalf("出力先の作成に失敗: %v", err)
 	}
+	baseSink := sink
 
-	log.Printf("検出されたクラス数: %d", len(classDirs))
+	// コピー時の変換（向きの反映・メタデータの削除・リサイズ・再エンコード）
+	if transform.Enabled() {
+		sink = processor.NewTransformSink(sink, transform)
+	}
 
-	// 処理の実行
+	// リストファイル・メタデータ出力用にコピー先を記録
+	var recorder *processor.RecordingSink
+	if config.ListFiles || config.MetadataJSONL {
+		recorder = processor.NewRecordingSink(sink)
+		sink = recorder
+	}
+
+	// 分割の決定
+	var plans []*processor.SplitPlan
 	if config.BinaryMode {
-		if err := processBinaryClassification(config, classDirs); err != nil {
+		plans, err = processor.PlanBinaryClassification(config, classes)
+		if err != nil {
+			sink.Close()
 			log.Fatalf("二値分類処理に失敗: %v", err)
 		}
 	} else {
-		if err := processClassesParallel(config, classDirs); err != nil {
+		plans, err = planClassesParallel(config, classes)
+		if err != nil {
+			sink.Close()
 			log.Fatalf("並列処理に失敗: %v", err)
 		}
 	}
 
-	// tar出力
-	if config.TarOutput {
-		if err := createTarArchive(config.DestDir); err != nil {
-			log.Printf("警告: tar出力に失敗: %v", err)
+	// 教師データと検証データにまたがる類似画像の検出
+	var leaks []processor.LeakPair
+	if config.LeakCheck {
+		leaks = processor.CheckLeakage(plans, config.LeakDistance, config.LeakFix, config.MaxCopyWorkers)
+	}
+
+	// ファイルのコピー
+	log.Printf("ファイルのコピーを開始...")
+	if err := processor.CopyPlans(sink, plans, config.MaxConcurrent, config.MaxCopyWorkers); err != nil {
+		if config.BinaryMode {
+			sink.Close()
+			log.Fatalf("二値分類処理に失敗: %v", err)
+		}
+		log.Printf("警告: %v", err)
+	}
+
+	// リストファイル・メタデータの出力
+	if recorder != nil {
+		records := recorder.Records()
+		if config.ListFiles {
+			if err := processor.WriteListFiles(sink, records); err != nil {
+				log.Printf("警告: リストファイルの出力に失敗: %v", err)
+			}
+		}
+		if config.MetadataJSONL {
+			// binary_label列は二値分類モードの場合のみ出力する
+			positiveClass := ""
+			if config.BinaryMode {
+				positiveClass = config.PositiveClass
+			}
+			if err := processor.WriteMetadataFiles(sink, records, positiveClass); err != nil {
+				log.Printf("警告: metadata.jsonlの出力に失敗: %v", err)
+			}
+		}
+	}
+
+	// 重複ファイルの一覧の出力
+	if len(duplicates) > 0 {
+		if err := processor.WriteDuplicateReport(baseSink, duplicates); err != nil {
+			log.Printf("警告: 重複ファイルの一覧の出力に失敗: %v", err)
+		}
+	}
+
+	// ラベルの矛盾の一覧の出力
+	if len(conflicts) > 0 {
+		if err := processor.WriteLabelConflictReport(baseSink, conflicts); err != nil {
+			log.Printf("警告: ラベルの矛盾の一覧の出力に失敗: %v", err)
+		}
+	}
+
+	// 類似画像の一覧の出力
+	if len(leaks) > 0 {
+		if err := processor.WriteLeakageReport(baseSink, leaks); err != nil {
+			log.Printf("警告: 類似画像の一覧の出力に失敗: %v", err)
+		}
+	}
+
+	// 8ビットRGB以外の画像の一覧の出力
+	if len(colorModeFiles) > 0 {
+		if err := processor.WriteColorModeReport(baseSink, colorModeFiles); err != nil {
+			log.Printf("警告: 8ビットRGB以外の画像の一覧の出力に失敗: %v", err)
+		}
+	}
+
+	// 走査時に除外したファイルの一覧の出力
+	if processor.CountExcluded(classes) > 0 {
+		if err := processor.WriteExcludedReport(baseSink, classes); err != nil {
+			log.Printf("警告: 走査時に除外したファイルの一覧の出力に失敗: %v", err)
+		}
+	}
+
+	// 除外した画像の一覧・コピーの出力（リストファイル・メタデータには含めない）
+	if len(quarantined) > 0 {
+		if err := processor.WriteQuarantine(baseSink, quarantined, config.Quarantine); err != nil {
+			log.Printf("警告: 除外した画像の出力に失敗: %v", err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		log.Fatalf("出力の確定に失敗: %v", err)
+	}
+
+	// アーカイブ出力（直接出力時は作成済み）
+	if config.GetArchiveFormat() != "" && !config.ArchiveDirect {
+		if err := createArchive(config, s3); err != nil {
+			log.Printf("警告: アーカイブ出力に失敗: %v", err)
 		}
 	}
 
 	log.Printf("データセット分割が完了しました！")
 }
 
+// stringList は複数回指定可能なフラグの値
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 // parseFlags はコマンドライン引数を解析
 func parseFlags() *config.Config {
 	cfg := config.NewDefaultConfig()
 
-	flag.StringVar(&cfg.SourceDir, "source", "", "ソースディレクトリ")
-	flag.StringVar(&cfg.DestDir, "dest", "", "出力先ディレクトリ")
+	registerSourceFlags(flag.CommandLine, cfg)
+	flag.StringVar(&cfg.DestDir, "dest", "", "出力先ディレクトリまたはS3のプレフィックス (s3://bucket/prefix)")
 	flag.Float64Var(&cfg.TrainingRatio, "ratio", cfg.TrainingRatio, "教師データ比率 (0.0-1.0)")
-	flag.IntVar(&cfg.MinFileCount, "min-files", cfg.MinFileCount, "最小ファイル数")
-	flag.BoolVar(&cfg.TarOutput, "tar", cfg.TarOutput, "tar出力フラグ")
-	flag.IntVar(&cfg.MaxConcurrent, "max-concurrent", cfg.MaxConcurrent, "最大並列度")
-	flag.IntVar(&cfg.MaxCopyWorkers, "copy-workers", cfg.MaxCopyWorkers, "最大コピーワーカー数")
+	flag.StringVar(&cfg.LabelConflicts, "label-conflicts", cfg.LabelConflicts, "内容が同じファイルが異なるクラス・サブクラスに属する場合の扱い (report: 一覧のみ, drop: すべて除外, first: 最初のラベルに残す, majority: 多数のラベルに残す)")
+	flag.StringVar(&cfg.Dedup, "dedup", cfg.Dedup, "内容が同じファイル（SHA-256）の扱い (first: 最初のみ残す, drop: すべて除外, error: 中断)")
+	flag.BoolVar(&cfg.LeakCheck, "leak-check", cfg.LeakCheck, "教師データと検証データにまたがる類似画像（dHash）を検出して一覧を出力")
+	flag.IntVar(&cfg.LeakDistance, "leak-distance", cfg.LeakDistance, "類似とみなすdHashのハミング距離 (0-32)")
+	flag.BoolVar(&cfg.LeakFix, "leak-fix", cfg.LeakFix, "類似画像の組の検証データ側を教師データへ移す")
+	flag.StringVar(&cfg.VerifyImages, "verify-images", cfg.VerifyImages, "分割前に画像をデコードして検証 (header: ヘッダーのみ, full: 画像全体)")
+	flag.BoolVar(&cfg.Quarantine, "quarantine", cfg.Quarantine, "検証で除外したファイルを quarantine/ にコピー")
+	flag.IntVar(&cfg.MinWidth, "min-width", cfg.MinWidth, "画像の幅の下限（ピクセル、0: 制限なし）")
+	flag.IntVar(&cfg.MaxWidth, "max-width", cfg.MaxWidth, "画像の幅の上限（ピクセル、0: 制限なし）")
+	flag.IntVar(&cfg.MinHeight, "min-height", cfg.MinHeight, "画像の高さの下限（ピクセル、0: 制限なし）")
+	flag.IntVar(&cfg.MaxHeight, "max-height", cfg.MaxHeight, "画像の高さの上限（ピクセル、0: 制限なし）")
+	flag.Float64Var(&cfg.MinAspect, "min-aspect", cfg.MinAspect, "縦横比（幅÷高さ）の下限（0: 制限なし）")
+	flag.Float64Var(&cfg.MaxAspect, "max-aspect", cfg.MaxAspect, "縦横比（幅÷高さ）の上限（0: 制限なし）")
+	flag.BoolVar(&cfg.ApplyOrientation, "exif-orientation", cfg.ApplyOrientation, "コピー時にJPEGのEXIFの向きを画素に反映（回転・反転して再エンコード）")
+	flag.BoolVar(&cfg.StripMetadata, "strip-metadata", cfg.StripMetadata, "コピー時にEXIF（位置情報を含む）・XMP・IPTCを取り除く（JPEG, PNG, WebP）")
+	flag.IntVar(&cfg.MaxSide, "max-side", cfg.MaxSide, "コピー時に長辺をこの値（ピクセル）まで縮小（0: 縮小しない）")
+	flag.StringVar(&cfg.ResizeSize, "resize", cfg.ResizeSize, "コピー時にリサイズする大きさ（幅x高さ、例: 224x224）")
+	flag.StringVar(&cfg.ResizeMode, "resize-mode", cfg.ResizeMode, "-resize の合わせ方 (fit: 余白を黒で埋める, fill: 引き伸ばす, crop: 中央を切り出す)")
+	flag.StringVar(&cfg.Encode, "encode", cfg.Encode, "コピー時に再エンコードする形式 (jpeg, png)")
+	flag.IntVar(&cfg.Quality, "quality", cfg.Quality, "再エンコードするJPEGの品質 (1-100)")
+	flag.StringVar(&cfg.ColorMode, "color-mode", cfg.ColorMode, "コピー時に変換する色モード (rgb: 8ビットRGB, gray: 8ビットグレースケール)")
+	flag.StringVar(&cfg.ColorCheck, "color-check", cfg.ColorCheck, "8ビットRGB以外の画像（グレースケール・CMYK・パレット・透過・16ビット）の扱い (report: 一覧のみ, convert: コピー時に8ビットRGBへ変換, exclude: 除外)")
+	flag.BoolVar(&cfg.TarOutput, "tar", cfg.TarOutput, "tar出力フラグ（-archive tar と同等）")
+	flag.StringVar(&cfg.ArchiveFormat, "archive", cfg.ArchiveFormat, "アーカイブ形式 (tar, tar.gz, zip)")
+	flag.BoolVar(&cfg.ArchiveDirect, "archive-direct", cfg.ArchiveDirect, "出力ディレクトリを作らずアーカイブへ直接書き込む")
+	flag.StringVar(&cfg.ArchivePath, "archive-path", cfg.ArchivePath, "アーカイブの出力パス（既定: 出力先ディレクトリ名 + 拡張子）")
+	flag.BoolVar(&cfg.ArchivePerSplit, "archive-per-split", cfg.ArchivePerSplit, "分割ごとに個別のアーカイブを作成")
+	flag.BoolVar(&cfg.ReproducibleArchive, "reproducible", cfg.ReproducibleArchive, "再現可能なアーカイブを作成（エントリ整列・所有者と更新日時の固定）")
+	flag.IntVar(&cfg.CompressionLevel, "compression-level", cfg.CompressionLevel, "圧縮レベル (-1: 既定, 0-9)")
+	flag.BoolVar(&cfg.ListFiles, "list-files", cfg.ListFiles, "train.txt / val.txt / classes.txt のリストファイルを出力")
+	flag.BoolVar(&cfg.MetadataJSONL, "metadata-jsonl", cfg.MetadataJSONL, "Hugging Face imagefolder形式のmetadata.jsonlを分割ごとに出力")
 	flag.BoolVar(&cfg.BinaryMode, "binary", cfg.BinaryMode, "二値分類モード")
 	flag.StringVar(&cfg.PositiveClass, "positive", cfg.PositiveClass, "positiveクラス名")
 
@@ -81,34 +297,223 @@ func parseFlags() *config.Config {
 	return cfg
 }
 
-// processClassesParallel は並列処理を実行
-func processClassesParallel(config *config.Config, classDirs []string) error {
-	return processor.ProcessClassesParallel(config, classDirs, func(classDir string) error {
-		return processClassDirectory(config, classDir)
-	})
+// parseStatsFlags は stats サブコマンドの引数を解析
+func parseStatsFlags(args []string) *config.Config {
+	cfg := config.NewDefaultConfig()
+
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	registerSourceFlags(fs, cfg)
+	fs.StringVar(&cfg.StatsFormat, "format", cfg.StatsFormat, "出力形式 (table, json, markdown)")
+
+	fs.Parse(args)
+
+	return cfg
 }
 
-// processClassDirectory は個別クラスディレクトリを処理
-func processClassDirectory(config *config.Config, classDir string) error {
-	className := utils.GetClassName(classDir)
-	log.Printf("クラス '%s' を処理中...", className)
+// registerSourceFlags はソースの読み込みに関するフラグを登録（分割と stats サブコマンドで共通）
+func registerSourceFlags(fs *flag.FlagSet, cfg *config.Config) {
+	fs.Var((*stringList)(&cfg.SourceDirs), "source", "ソースディレクトリ、アーカイブ (.tar, .tar.gz, .zip) またはS3のプレフィックス (s3://bucket/prefix)。複数回指定すると統合")
+	fs.StringVar(&cfg.MergePolicy, "merge-conflict", cfg.MergePolicy, "複数ソースでファイル名が衝突した場合の方針 (first, rename, error)")
+	fs.StringVar(&cfg.ArchiveRoot, "archive-root", cfg.ArchiveRoot, "アーカイブ内でソースのルートとして使うディレクトリ（既定: 直下が単一のディレクトリでクラス/サブクラスの構造を含む場合はそのディレクトリ。. でアーカイブ直下）")
+	fs.StringVar(&cfg.LabelFile, "labels", cfg.LabelFile, "ラベルファイル (path,label[,coarse_label][,group] のCSVまたはJSONL)")
+	fs.BoolVar(&cfg.Resplit, "resplit", cfg.Resplit, "ソースを以前の実行の出力（train/validation）として読み込み、分割し直す")
+	fs.StringVar(&cfg.S3Endpoint, "s3-endpoint", cfg.S3Endpoint, "S3互換オブジェクトストレージのエンドポイント（既定: AWS_ENDPOINT_URL またはAWS）")
+	fs.StringVar(&cfg.S3Region, "s3-region", cfg.S3Region, "S3のリージョン（既定: AWS_REGION または us-east-1）")
+	fs.StringVar(&cfg.FileTypes, "file-types", cfg.FileTypes, "対象とするファイル種別（カンマ区切り: image, audio, text）")
+	fs.StringVar(&cfg.Extensions, "extensions", cfg.Extensions, "追加で対象とする拡張子（カンマ区切り: .jxl,.avif など）")
+	fs.StringVar(&cfg.Include, "include", cfg.Include, "対象とするファイルのglobパターン（カンマ区切り）")
+	fs.StringVar(&cfg.Exclude, "exclude", cfg.Exclude, "除外するファイル・ディレクトリのglobパターン（カンマ区切り）")
+	fs.BoolVar(&cfg.FollowSymlinks, "follow-symlinks", cfg.FollowSymlinks, "シンボリックリンクをたどって走査（循環の検出・同一実体の重複除去を行う）")
+	fs.BoolVar(&cfg.KeepJunk, "keep-junk", cfg.KeepJunk, "隠しファイル・OSやNASのメタデータ（._*, .DS_Store, @eaDir など）を除外しない")
+	fs.BoolVar(&cfg.Sniff, "sniff", cfg.Sniff, "ファイル先頭のバイト列で形式を判定（拡張子の誤り・HTMLエラーページの検出、拡張子のないファイルの取り込み）")
+	fs.StringVar(&cfg.SniffMismatch, "sniff-mismatch", cfg.SniffMismatch, "-sniff で拡張子と内容の形式が異なるファイルの扱い (keep: 警告のみ, rename: 内容の形式の拡張子で出力, drop: 除外)")
+	fs.StringVar(&cfg.MinSize, "min-size", cfg.MinSize, "対象とするファイルサイズの下限（例: 1KB。既定の1は空のファイルを除外、0で制限なし）")
+	fs.StringVar(&cfg.MaxSize, "max-size", cfg.MaxSize, "対象とするファイルサイズの上限（例: 50MB。空・0で制限なし）")
+	fs.IntVar(&cfg.MinFileCount, "min-files", cfg.MinFileCount, "最小ファイル数")
+	fs.IntVar(&cfg.MaxConcurrent, "max-concurrent", cfg.MaxConcurrent, "最大並列度")
+	fs.IntVar(&cfg.MaxCopyWorkers, "copy-workers", cfg.MaxCopyWorkers, "最大コピーワーカー数")
+}
 
-	// サブディレクトリの取得
-	subDirs, err := utils.GetSubDirectories(classDir)
+// newS3Client は設定からS3クライアントを作成（S3を使用しない場合はnil）
+func newS3Client(config *config.Config) (*storage.S3Client, error) {
+	if !config.UsesS3() {
+		return nil, nil
+	}
+	client, err := storage.NewS3Client(config.S3Endpoint, config.S3Region)
 	if err != nil {
-		return fmt.Errorf("サブディレクトリの取得に失敗: %v", err)
+		return nil, err
 	}
+	log.Printf("S3エンドポイント: %s", client.Endpoint())
+	return client, nil
+}
 
-	// 各サブディレクトリを処理
-	for _, subDir := range subDirs {
-		subDirName := utils.GetClassName(subDir)
-		log.Printf("  サブディレクトリ '%s' を処理中...", subDirName)
+// newArchiveOptions は設定からアーカイブ出力の設定を作成
+func newArchiveOptions(config *config.Config, s3 *storage.S3Client) processor.ArchiveOptions {
+	opts := processor.NewArchiveOptions(config)
+	opts.S3 = s3
+	return opts
+}
+
+// newSink は設定に応じた出力先を作成
+func newSink(config *config.Config, s3 *storage.S3Client) (processor.Sink, error) {
+	if config.ArchiveDirect {
+		opts := newArchiveOptions(config, s3)
+		if config.ArchivePerSplit {
+			return processor.NewSplitArchiveSink(config.GetArchivePath, opts), nil
+		}
+		return processor.NewArchiveSink(config.GetArchivePath(""), opts)
+	}
+	if storage.IsS3URL(config.DestDir) {
+		return processor.NewS3Sink(s3, config.DestDir)
+	}
+	return processor.NewDirSink(config.DestDir), nil
+}
+
+// loadClasses はソースからクラス・サブクラス構造を取得（対象ファイルが1件もない場合はエラー）
+func loadClasses(config *config.Config, sources []*source.Source) ([]*dataset.Class, error) {
+	classes, err := readClasses(config, sources)
+	if err != nil {
+		return nil, err
+	}
+	if countFiles(classes) == 0 {
+		return nil, fmt.Errorf("対象ファイルが見つかりません（クラス/サブクラス/ファイル の構造になっているか確認してください）")
+	}
+	return classes, nil
+}
+
+// readClasses はラベルファイル・以前の出力・ディレクトリ構造のいずれかからデータセットを読み込む
+// 複数のソースが指定された場合は同名のクラス・サブクラスを統合する
+func readClasses(config *config.Config, sources []*source.Source) ([]*dataset.Class, error) {
+	if config.LabelFile != "" {
+		log.Printf("ラベルファイル: %s", config.LabelFile)
+		return source.LoadLabelFile(config.LabelFile, sources[0].FS)
+	}
+
+	opts, err := newScanOptions(config)
+	if err != nil {
+		return nil, err
+	}
 
-		// 画像ファイルの取得
-		files, err := utils.GetImageFiles(subDir)
+	var roots [][]*dataset.Class
+	var rootNames []string
+	for _, src := range sources {
+		var classes []*dataset.Class
+		var err error
+		if config.Resplit {
+			classes, err = source.LoadPreviousOutput(src.FS, opts)
+		} else {
+			classes, err = source.ScanTree(src.FS, opts, config.MaxConcurrent)
+		}
 		if err != nil {
-			log.Printf("    警告: ファイル一覧の取得に失敗: %v", err)
-			continue
+			return nil, fmt.Errorf("%s: %v", src.Path, err)
+		}
+		roots = append(roots, classes)
+		rootNames = append(rootNames, src.Path)
+	}
+
+	if len(roots) == 1 {
+		return roots[0], nil
+	}
+	return source.MergeClasses(roots, rootNames, config.MergePolicy)
+}
+
+// countFiles はデータセット内のファイル数を返す
+func countFiles(classes []*dataset.Class) int {
+	count := 0
+	for _, class := range classes {
+		for _, sub := range class.Subclasses {
+			count += len(sub.Files)
+		}
+	}
+	return count
+}
+
+// openSources はソースを開く（ディレクトリ、アーカイブまたはS3）
+func openSources(config *config.Config, s3 *storage.S3Client) ([]*source.Source, error) {
+	var sources []*source.Source
+	for _, sourceDir := range config.SourceDirs {
+		var src *source.Source
+		var err error
+		if storage.IsS3URL(sourceDir) {
+			src, err = source.OpenS3(s3, sourceDir)
+		} else {
+			src, err = source.Open(sourceDir, config.ArchiveRoot)
+		}
+		if err != nil {
+			closeSources(sources)
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// closeSources はソースを閉じる
+func closeSources(sources []*source.Source) {
+	for _, src := range sources {
+		src.Close()
+	}
+}
+
+// newScanOptions は設定からファイル走査の設定を作成
+func newScanOptions(cfg *config.Config) (utils.ScanOptions, error) {
+	extensions, err := utils.NewExtensionSet(cfg.GetFileTypes(), cfg.GetExtensions())
+	if err != nil {
+		return utils.ScanOptions{}, err
+	}
+	minSize, err := cfg.GetMinSize()
+	if err != nil {
+		return utils.ScanOptions{}, err
+	}
+	maxSize, err := cfg.GetMaxSize()
+	if err != nil {
+		return utils.ScanOptions{}, err
+	}
+	log.Printf("対象拡張子: %s", strings.Join(extensions.List(), " "))
+	return utils.ScanOptions{
+		Extensions:     extensions,
+		Include:        cfg.GetIncludePatterns(),
+		Exclude:        cfg.GetExcludePatterns(),
+		FollowSymlinks: cfg.FollowSymlinks,
+		SkipJunk:       !cfg.KeepJunk,
+		Sniff:          cfg.Sniff,
+		RenameMismatch: cfg.SniffMismatch == config.MismatchRename,
+		DropMismatch:   cfg.SniffMismatch == config.MismatchDrop,
+		MinSize:        minSize,
+		MaxSize:        maxSize,
+	}, nil
+}
+
+// planClassesParallel はクラスごとの分割を並列に決定
+func planClassesParallel(config *config.Config, classes []*dataset.Class) ([]*processor.SplitPlan, error) {
+	var mu sync.Mutex
+	var plans []*processor.SplitPlan
+
+	err := processor.ProcessClassesParallel(config, classes, func(class *dataset.Class) error {
+		classPlans := planClass(config, class)
+		mu.Lock()
+		defer mu.Unlock()
+		plans = append(plans, classPlans...)
+		return nil
+	})
+
+	processor.SortPlans(plans)
+	return plans, err
+}
+
+// planClass は個別クラスのサブクラスごとの分割を決定
+func planClass(config *config.Config, class *dataset.Class) []*processor.SplitPlan {
+	log.Printf("クラス '%s' を処理中...", class.Name)
+
+	// 各サブクラスを処理
+	var plans []*processor.SplitPlan
+	for _, sub := range class.Subclasses {
+		subDirName := sub.Name
+		files := sub.Files
+		log.Printf("  サブディレクトリ '%s' を処理中...", subDirName)
+
+		if summary := sub.SkippedSummary(); summary != "" {
+			log.Printf("    除外: %s", summary)
 		}
 
 		if len(files) == 0 {
@@ -125,31 +530,51 @@ func processClassDirectory(config *config.Config, classDir string) error {
 		}
 
 		// ファイルの分割
-		trainingCount := int(float64(len(files)) * config.TrainingRatio)
-		trainingFiles := files[:trainingCount]
-		validationFiles := files[trainingCount:]
-
-		// ファイルのコピー
-		if err := processor.CopyFilesParallel(config.DestDir, "train", subDirName, trainingFiles, config.MaxCopyWorkers); err != nil {
-			log.Printf("    警告: 教師データのコピーに失敗: %v", err)
-		}
-
-		if err := processor.CopyFilesParallel(config.DestDir, "validation", subDirName, validationFiles, config.MaxCopyWorkers); err != nil {
-			log.Printf("    警告: 検証データのコピーに失敗: %v", err)
-		}
+		trainingFiles, validationFiles := processor.SplitFiles(files, config.TrainingRatio)
+		plans = append(plans, &processor.SplitPlan{
+			Class:      class.Name,
+			Name:       subDirName,
+			Train:      trainingFiles,
+			Validation: validationFiles,
+		})
 
-		log.Printf("    完了: 教師データ %d件, 検証データ %d件", len(trainingFiles), len(validationFiles))
+		log.Printf("    分割: 教師データ %d件, 検証データ %d件", len(trainingFiles), len(validationFiles))
 	}
 
-	return nil
+	return plans
 }
 
-// processBinaryClassification は二値分類処理
-func processBinaryClassification(config *config.Config, classDirs []string) error {
-	return processor.ProcessBinaryClassification(config, classDirs)
+// createArchive はアーカイブを作成
+func createArchive(config *config.Config, s3 *storage.S3Client) error {
+	// 分割ごとのアーカイブでは quarantine/ も個別のアーカイブにする（直接出力時と同じ）
+	return processor.CreateArchives(config, newArchiveOptions(config, s3), []string{"train", "validation", processor.QuarantineDir})
 }
 
-// createTarArchive はtarアーカイブを作成
-func createTarArchive(destDir string) error {
-	return processor.CreateTarArchive(destDir)
+// runStats は分割せずにデータセットの統計を標準出力へ出力（stats サブコマンド）
+func runStats(args []string) {
+	config := parseStatsFlags(args)
+	if err := config.ValidateStats(); err != nil {
+		log.Fatalf("設定エラー: %v", err)
+	}
+
+	s3, err := newS3Client(config)
+	if err != nil {
+		log.Fatalf("S3クライアントの作成に失敗: %v", err)
+	}
+
+	sources, err := openSources(config, s3)
+	if err != nil {
+		log.Fatalf("ソースを開けません: %v", err)
+	}
+	defer closeSources(sources)
+
+	classes, err := loadClasses(config, sources)
+	if err != nil {
+		log.Fatalf("クラスの取得に失敗: %v", err)
+	}
+
+	stats := processor.CollectStats(classes, config.MinFileCount, config.MaxCopyWorkers)
+	if err := processor.WriteStats(os.Stdout, stats, config.StatsFormat); err != nil {
+		log.Fatalf("統計の出力に失敗: %v", err)
+	}
 }